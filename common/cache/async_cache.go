@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"github.com/vvwyy/peanut/concurrent"
+)
+
+// AsyncLoadingCache 异步加载的缓存，Get 立即返回 concurrent.Future
+//
+// 缓存的值是 Future 本身：加载中的 Future 同样会被缓存，同一个 key 并发的 Get 共享同一个 Future；
+// 加载失败（或被取消）的 Future 会被自动移除。过期、容量等配置同 Builder.Build，
+// 作用于 Future 上（Weigher、RemovalListener 收到的值也是 Future）。
+type AsyncLoadingCache struct {
+	cache    *LocalCache
+	loader   Loader
+	executor *concurrent.Executor
+}
+
+// BuildAsync 创建 AsyncLoadingCache，加载在 Builder.Executor 设置的 executor 中执行
+func (builder *Builder) BuildAsync(loader Loader) *AsyncLoadingCache {
+	async := &AsyncLoadingCache{
+		loader:   loader,
+		executor: builder.executor,
+	}
+	if async.executor == nil {
+		async.executor = defaultExecutor
+	}
+	async.cache = builder.build(nil)
+	return async
+}
+
+// Get 返回 key 对应的 Future，不存在时提交异步加载；没有 loader 时返回失败的 Future
+func (async *AsyncLoadingCache) Get(key interface{}) concurrent.Future {
+	if async.loader == nil {
+		return concurrent.NewFailedFuture(NoLoaderError)
+	}
+	value, err := async.cache.GetWithLoader(key, futureLoader{async: async})
+	if err != nil {
+		return concurrent.NewFailedFuture(err)
+	}
+	future := value.(concurrent.Future)
+	async.removeIfFailed(key, future)
+	return future
+}
+
+// GetIfPresent 返回 key 对应的 Future，不存在时返回 nil
+func (async *AsyncLoadingCache) GetIfPresent(key interface{}) concurrent.Future {
+	if value := async.cache.GetIfPresent(key); value != nil {
+		return value.(concurrent.Future)
+	}
+	return nil
+}
+
+// Put 缓存 key 对应的 Future，Future 失败时同样会被移除
+func (async *AsyncLoadingCache) Put(key interface{}, future concurrent.Future) {
+	async.cache.Put(key, future)
+	async.watch(key, future)
+}
+
+func (async *AsyncLoadingCache) Delete(key interface{}) {
+	async.cache.Delete(key)
+}
+
+// Close 停止后台清理，见 LocalCache.Close
+func (async *AsyncLoadingCache) Close() {
+	async.cache.Close()
+}
+
+// Stats 返回缓存统计数据的快照，加载耗时为提交加载任务的耗时
+func (async *AsyncLoadingCache) Stats() CacheStats {
+	return async.cache.Stats()
+}
+
+// watch 在 future 失败后将其从缓存中移除
+func (async *AsyncLoadingCache) watch(key interface{}, future concurrent.Future) {
+	go func() {
+		if _, err := future.Get(); err != nil {
+			async.cache.CompareAndDelete(key, future)
+		}
+	}()
+}
+
+// removeIfFailed 处理 future 在写入缓存之前就已经失败的情况（此时 watch 可能先于写入完成）
+func (async *AsyncLoadingCache) removeIfFailed(key interface{}, future concurrent.Future) {
+	if !future.IsDone() {
+		return
+	}
+	if future.IsCancelled() {
+		async.cache.CompareAndDelete(key, future)
+		return
+	}
+	if _, err := future.Get(); err != nil {
+		async.cache.CompareAndDelete(key, future)
+	}
+}
+
+// futureLoader 将加载提交到 executor，立即返回加载的 Future
+type futureLoader struct {
+	async *AsyncLoadingCache
+}
+
+func (loader futureLoader) Load(key interface{}) (interface{}, error) {
+	async := loader.async
+	future := async.executor.Go(func() (interface{}, error) {
+		return async.loader.Load(key)
+	})
+	async.watch(key, future)
+	return future, nil
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vvwyy/peanut/concurrent"
+)
+
+type slowLoader struct {
+	loads int32
+	fail  bool
+}
+
+func (loader *slowLoader) Load(key interface{}) (interface{}, error) {
+	atomic.AddInt32(&loader.loads, 1)
+	time.Sleep(100 * time.Millisecond)
+	if loader.fail {
+		return nil, errors.New("load failed")
+	}
+	return key, nil
+}
+
+func TestAsyncLoadingCache_Get(t *testing.T) {
+	loader := &slowLoader{}
+	cache := NewBuilder().
+		Executor(concurrent.NewExecutor()).
+		BuildAsync(loader)
+
+	// Get 立即返回
+	start := time.Now()
+	futures := make([]concurrent.Future, 10)
+	var wg sync.WaitGroup
+	for i := range futures {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			futures[i] = cache.Get("a")
+		}(i)
+	}
+	wg.Wait()
+	if time.Since(start) >= 100*time.Millisecond {
+		t.FailNow()
+	}
+
+	// 并发的 Get 共享同一个 Future
+	for _, future := range futures {
+		if future != futures[0] {
+			t.FailNow()
+		}
+		if value, err := future.Get(); err != nil || value != "a" {
+			t.FailNow()
+		}
+	}
+	if atomic.LoadInt32(&loader.loads) != 1 {
+		t.FailNow()
+	}
+	if cache.GetIfPresent("a") != futures[0] {
+		t.FailNow()
+	}
+}
+
+func TestAsyncLoadingCache_Failed(t *testing.T) {
+	loader := &slowLoader{fail: true}
+	cache := NewBuilder().BuildAsync(loader)
+
+	future := cache.Get("a")
+	if _, err := future.Get(); err == nil {
+		t.FailNow()
+	}
+
+	// 失败的 Future 被自动移除
+	time.Sleep(10 * time.Millisecond)
+	if cache.GetIfPresent("a") != nil {
+		t.FailNow()
+	}
+	if cache.Get("a") == future {
+		t.FailNow()
+	}
+}
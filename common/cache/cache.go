@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/vvwyy/peanut/concurrent"
+)
+
+// Cache 缓存的基本操作，实现需要是并发安全的
+//
+// 其它操作分别定义在 ConditionalCache、ComputingCache、InvalidatingCache 等可选的接口中，
+// Builder.Build 返回的缓存实现了所有这些接口，可以通过类型断言获取。
+type Cache interface {
+	// GetIfPresent 返回 key 对应的值，不存在或者已过期时返回 nil
+	GetIfPresent(key interface{}) interface{}
+	Put(key, value interface{})
+	Delete(key interface{})
+	// Range 遍历缓存中未过期的 entry，f 返回 false 时停止遍历
+	Range(f func(key, value interface{}) bool)
+	// Size 返回缓存中未过期的 entry 数量，需要遍历所有 entry
+	Size() int
+	// Cleanup 移除过期的 entry 并释放已删除的 entry 占用的内存
+	Cleanup()
+}
+
+// LoadingCache 未命中时通过 Loader 加载的缓存
+type LoadingCache interface {
+	Cache
+	// Get 返回 key 对应的值，未命中时通过创建时设置的 loader 加载，没有 loader 时同 GetIfPresent
+	Get(key interface{}) (interface{}, error)
+	// GetAll 返回多个 key 对应的值，未命中的 key 通过 loader 加载
+	GetAll(keys []interface{}) (map[interface{}]interface{}, error)
+	// Refresh 异步重新加载 key 对应的值
+	Refresh(key interface{}) concurrent.Future
+}
+
+// LoaderCache 每次调用时指定 loader 的缓存
+type LoaderCache interface {
+	// GetWithLoader 同 Get，未命中时通过 loader 加载
+	GetWithLoader(key interface{}, loader Loader) (interface{}, error)
+}
+
+// ConditionalCache 按 key 当前的值有条件地写入
+type ConditionalCache interface {
+	// PutIfAbsent key 不存在时写入 value，已存在时返回已存在的值及 true
+	PutIfAbsent(key, value interface{}) (existing interface{}, loaded bool)
+	// Replace key 存在时将其值替换为 value，返回被替换的值及 true
+	Replace(key, value interface{}) (previous interface{}, replaced bool)
+	// CompareAndSwap key 的值等于 old 时替换为 new
+	CompareAndSwap(key, old, new interface{}) (swapped bool)
+	// CompareAndDelete key 的值等于 old 时删除
+	CompareAndDelete(key, old interface{}) (deleted bool)
+}
+
+// ComputingCache 原子地读-改-写 key 的值
+type ComputingCache interface {
+	// Compute 原子地将 key 的值替换为 remapping 的结果，返回 nil 时删除 key
+	Compute(key interface{}, remapping func(key, oldValue interface{}) interface{}) interface{}
+	// ComputeIfAbsent key 不存在时原子地将其值设置为 mapping 的结果
+	ComputeIfAbsent(key interface{}, mapping func(key interface{}) interface{}) interface{}
+	// ComputeIfPresent key 存在时原子地将其值替换为 remapping 的结果，返回 nil 时删除 key
+	ComputeIfPresent(key interface{}, remapping func(key, oldValue interface{}) interface{}) interface{}
+	// Merge key 不存在时写入 value，否则原子地将其值替换为 remapping 的结果，返回 nil 时删除 key
+	Merge(key, value interface{}, remapping func(oldValue, value interface{}) interface{}) interface{}
+}
+
+// InvalidatingCache 批量查看及删除 entry
+type InvalidatingCache interface {
+	// Keys 返回所有未过期的 key
+	Keys() []interface{}
+	// InvalidateKeys 删除 keys 对应的 entry
+	InvalidateKeys(keys []interface{})
+	// InvalidateAll 删除所有 entry
+	InvalidateAll()
+}
+
+// ExpiringCache 按 entry 设置过期时间
+type ExpiringCache interface {
+	// PutWithTTL 写入 key 的值并设置 ttl 后过期
+	PutWithTTL(key, value interface{}, ttl time.Duration)
+}
+
+// StatsCache 缓存的统计数据
+type StatsCache interface {
+	// EstimatedSize 返回 entry 数量的估计值，包括已过期但还未被移除的 entry
+	EstimatedSize() int
+	// Stats 返回缓存统计数据的快照
+	Stats() CacheStats
+}
+
+// Closer 有后台任务的缓存
+type Closer interface {
+	// Close 停止缓存的后台任务
+	Close()
+}
+
+// Builder.Build 返回的实现
+var (
+	_ LoadingCache      = (*LocalCache)(nil)
+	_ LoaderCache       = (*LocalCache)(nil)
+	_ ConditionalCache  = (*LocalCache)(nil)
+	_ ComputingCache    = (*LocalCache)(nil)
+	_ InvalidatingCache = (*LocalCache)(nil)
+	_ ExpiringCache     = (*LocalCache)(nil)
+	_ StatsCache        = (*LocalCache)(nil)
+	_ Closer            = (*LocalCache)(nil)
+
+	_ LoadingCache      = (*shardedCache)(nil)
+	_ LoaderCache       = (*shardedCache)(nil)
+	_ ConditionalCache  = (*shardedCache)(nil)
+	_ ComputingCache    = (*shardedCache)(nil)
+	_ InvalidatingCache = (*shardedCache)(nil)
+	_ ExpiringCache     = (*shardedCache)(nil)
+	_ StatsCache        = (*shardedCache)(nil)
+	_ Closer            = (*shardedCache)(nil)
+)
@@ -2,5 +2,19 @@ package cache
 
 type Loader interface {
 	Load(key interface{}) (interface{}, error)
-	//LoadAll(keys []interface{}) (map[string]interface{}, error)
+}
+
+// BulkLoader 可以一次加载多个 key 的 Loader，如数据库的 IN 查询
+//
+// LocalCache.GetAll 对所有未命中的 key 只调用一次 LoadAll；
+// 返回结果中没有的 key 视为不存在，不会写入缓存，返回结果中多出的 key 在不存在时写入缓存
+type BulkLoader interface {
+	Loader
+	LoadAll(keys []interface{}) (map[interface{}]interface{}, error)
+}
+
+// Reloader 可以由 Loader 实现，用于 RefreshAfterWrite 及 LocalCache.Refresh 时根据旧值重新加载；
+// 没有实现时通过 Load 重新加载
+type Reloader interface {
+	Reload(key, oldValue interface{}) (interface{}, error)
 }
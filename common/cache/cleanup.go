@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Cleanup 移除所有过期的 entry 并通知 RemovalListener，同时清理 read 和 dirty 中已被删除的 entry，释放其占用的内存
+//
+// 设置了 Builder.CleanupInterval 时由后台 goroutine 定期调用，也可以主动调用
+func (cache *LocalCache) Cleanup() {
+	cache.expireEntries(cache.now())
+	if cache.negative != nil {
+		cache.negative.Cleanup()
+	}
+
+	if atomic.LoadInt64(&cache.removed) > 0 {
+		cache.mu.Lock()
+		cache.compactLocked()
+		cache.mu.Unlock()
+	}
+}
+
+// Close 停止后台清理，可以重复调用；Close 之后缓存仍然可以使用
+func (cache *LocalCache) Close() {
+	cache.closeOnce.Do(func() {
+		if cache.closed != nil {
+			close(cache.closed)
+		}
+	})
+	if cache.negative != nil {
+		cache.negative.Close()
+	}
+}
+
+// now 返回 clock 的当前时间，entry 中的时间都以纳秒的形式保存
+func (cache *LocalCache) now() time.Duration {
+	return time.Duration(cache.getClock().Now().UnixNano())
+}
+
+func (cache *LocalCache) startCleanup(interval time.Duration) {
+	cache.closed = make(chan struct{})
+	go func() {
+		ticker := cache.getClock().NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				cache.Cleanup()
+			case <-cache.closed:
+				return
+			}
+		}
+	}()
+}
+
+// compactLocked 丢弃已被删除的 entry：将其标记为 expunged 后重建 read，并清空 dirty；
+// 之后对这些 key 的写入会在加锁后重新创建 entry
+func (cache *LocalCache) compactLocked() {
+	atomic.StoreInt64(&cache.removed, 0)
+
+	// dirty 不为 nil 时包含 read 中所有未被标记为删除的 entry，只需要检查 dirty
+	read, _ := cache.read.Load().(readOnly)
+	m := read.m
+	if read.amended {
+		m = cache.dirty
+	}
+
+	live := make(map[interface{}]*referenceEntry, len(m))
+	for key, entry := range m {
+		if !entry.tryExpungeLocked() {
+			live[key] = entry
+		}
+	}
+	cache.read.Store(readOnly{m: live})
+	cache.dirty = nil
+	cache.misses = 0
+}
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/vvwyy/peanut/common/clock"
+	"github.com/vvwyy/peanut/common/clock/clocktest"
+)
+
+func TestLocalCache_Cleanup(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	removed := make(chan RemovalNotification, 100)
+	cache := NewBuilder().
+		ExpireAfterWrite(100 * time.Millisecond).
+		CleanupInterval(50 * time.Millisecond).
+		Clock(fakeClock).
+		RemovalListener(func(notification RemovalNotification) {
+			removed <- notification
+		}).
+		Build(nil).(*LocalCache)
+	defer cache.Close()
+
+	for i := 0; i < 100; i++ {
+		cache.Put(i, fmt.Sprint(i))
+	}
+	// 写入后从未访问的 key 也会被后台清理
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(100 * time.Millisecond)
+
+	for i := 0; i < 100; i++ {
+		select {
+		case notification := <-removed:
+			if notification.Cause != EXPIRED {
+				t.Fatalf("unexpected cause %v for %v", notification.Cause, notification.Value)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected 100 notifications, got %d", i)
+		}
+	}
+
+	// 通知之后后台清理接着移除 read 和 dirty 中的 entry，等待其完成
+	size := func() int {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		read, _ := cache.read.Load().(readOnly)
+		return len(read.m) + len(cache.dirty)
+	}
+	for deadline := time.Now().Add(5 * time.Second); size() != 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected empty cache, got %d entries", size())
+		}
+		runtime.Gosched()
+	}
+
+	cache.Put("a", "a")
+	if cache.GetIfPresent("a") != "a" {
+		t.FailNow()
+	}
+}
+
+// stopRecordingClock 在 Ticker 停止时关闭 stopped
+type stopRecordingClock struct {
+	*clocktest.FakeClock
+	stopped chan struct{}
+}
+
+func (c *stopRecordingClock) NewTicker(d time.Duration) clock.Ticker {
+	return &stopRecordingTicker{Ticker: c.FakeClock.NewTicker(d), stopped: c.stopped}
+}
+
+type stopRecordingTicker struct {
+	clock.Ticker
+	stopped chan struct{}
+}
+
+func (t *stopRecordingTicker) Stop() {
+	t.Ticker.Stop()
+	close(t.stopped)
+}
+
+func TestLocalCache_Close(t *testing.T) {
+	fakeClock := &stopRecordingClock{
+		FakeClock: clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)),
+		stopped:   make(chan struct{}),
+	}
+	cache := NewBuilder().
+		ExpireAfterWrite(50 * time.Millisecond).
+		CleanupInterval(10 * time.Millisecond).
+		Clock(fakeClock).
+		Build(nil).(*LocalCache)
+	cache.Close()
+	cache.Close()
+	<-fakeClock.stopped
+
+	cache.Put("a", "a")
+	fakeClock.Advance(100 * time.Millisecond)
+	read, _ := cache.read.Load().(readOnly)
+	if _, ok := read.m["a"]; !ok {
+		if _, ok := cache.dirty["a"]; !ok {
+			t.Fatal("entry removed after Close")
+		}
+	}
+
+	// 没有后台清理时 Close 同样可以调用
+	NewBuilder().Build(nil).(*LocalCache).Close()
+}
+
+func TestLocalCache_CleanupFakeClock(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	removed := make(chan RemovalNotification, 10)
+	cache := NewBuilder().
+		ExpireAfterWrite(time.Minute).
+		CleanupInterval(time.Second).
+		Clock(fakeClock).
+		ConcurrencyLevel(4).
+		RemovalListener(func(notification RemovalNotification) {
+			removed <- notification
+		}).
+		Build(nil).(*shardedCache)
+	defer cache.Close()
+
+	for i := 0; i < 10; i++ {
+		cache.Put(i, fmt.Sprint(i))
+	}
+	// 等待后台清理的 goroutine 创建 Ticker 之后再推进时间
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(time.Minute)
+
+	for i := 0; i < 10; i++ {
+		select {
+		case notification := <-removed:
+			if notification.Cause != EXPIRED {
+				t.Fatalf("unexpected cause %v", notification.Cause)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected 10 notifications, got %d", i)
+		}
+	}
+}
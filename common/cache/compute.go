@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Compute 原子地将 key 的值替换为 remapping 的结果并返回：
+// 不存在（包括已过期）时 oldValue 为 nil；返回 nil 时删除 key
+//
+// 同一个 key 的 Compute 等方法依次执行，remapping 只会被调用一次，其中不能再修改同一个 key
+func (cache *LocalCache) Compute(key interface{}, remapping func(key, oldValue interface{}) interface{}) interface{} {
+	return cache.compute(key, func(oldValue interface{}, present bool) (interface{}, bool) {
+		return remapping(key, oldValue), true
+	})
+}
+
+// ComputeIfAbsent key 不存在（包括已过期）时将其值设置为 mapping 的结果，返回 key 当前的值；
+// mapping 返回 nil 时不写入
+func (cache *LocalCache) ComputeIfAbsent(key interface{}, mapping func(key interface{}) interface{}) interface{} {
+	return cache.compute(key, func(oldValue interface{}, present bool) (interface{}, bool) {
+		if present {
+			return oldValue, false
+		}
+		return mapping(key), true
+	})
+}
+
+// ComputeIfPresent key 存在时将其值替换为 remapping 的结果并返回，remapping 返回 nil 时删除 key；
+// key 不存在时返回 nil
+func (cache *LocalCache) ComputeIfPresent(key interface{}, remapping func(key, oldValue interface{}) interface{}) interface{} {
+	return cache.compute(key, func(oldValue interface{}, present bool) (interface{}, bool) {
+		if !present {
+			return nil, false
+		}
+		return remapping(key, oldValue), true
+	})
+}
+
+// Merge key 不存在时写入 value，否则将其值替换为 remapping(oldValue, value) 的结果，返回 key 当前的值；
+// remapping 返回 nil 时删除 key
+func (cache *LocalCache) Merge(key, value interface{}, remapping func(oldValue, value interface{}) interface{}) interface{} {
+	return cache.compute(key, func(oldValue interface{}, present bool) (interface{}, bool) {
+		if !present {
+			return value, true
+		}
+		return remapping(oldValue, value), true
+	})
+}
+
+// compute 原子地修改 key 的值
+//
+// remapping 的 present 表示 key 是否存在未过期的值，返回的 update 为 false 时不做修改；
+// newValue 为 nil 时删除 key。写入与 Put 一样更新过期时间并通知被替换的值，删除与 Delete 一样通知 EXPLICIT。
+//
+// 同一个 key 的 compute 依次执行，remapping 只会被调用一次。读取旧值之后 key 被 Put、Delete 等并发地修改时，
+// 视为本次 compute 先于该修改完成：计算出的值随即被替换，通知 REPLACED。
+func (cache *LocalCache) compute(key interface{}, remapping func(oldValue interface{}, present bool) (newValue interface{}, update bool)) interface{} {
+	lock := cache.lockKey(key)
+	defer cache.unlockKey(key, lock)
+
+	now := cache.now()
+	entry, ok := cache.getEntry(key)
+	var p unsafe.Pointer
+	if ok {
+		p = atomic.LoadPointer(&entry.p)
+	}
+	hasValue := p != nil && p != expunged
+	expired := hasValue && cache.isExpired(entry, now)
+
+	var oldValue interface{}
+	present := hasValue && !expired
+	if present {
+		oldValue = *(*interface{})(p)
+	}
+
+	newValue, update := remapping(oldValue, present)
+	if !update {
+		if present {
+			cache.recordRead(entry, oldValue, now)
+		}
+		return oldValue
+	}
+
+	cache.invalidateLoading(key)
+	if newValue == nil {
+		if !hasValue {
+			return nil
+		}
+		// CAS 失败时值已被并发地替换或者删除，删除先于该修改完成，不需要再做什么
+		if atomic.CompareAndSwapPointer(&entry.p, p, nil) {
+			cache.discard(entry)
+			if expired {
+				cache.stats().RecordEviction()
+				cache.notifyRemoval(key, *(*interface{})(p), EXPIRED)
+			} else {
+				cache.notifyRemoval(key, oldValue, EXPLICIT)
+			}
+		}
+		return nil
+	}
+
+	if hasValue {
+		// 有值的 entry 被删除时会先将值设为 nil，CAS 成功时 entry 一定还在 read 或者 dirty 中
+		if !atomic.CompareAndSwapPointer(&entry.p, p, unsafe.Pointer(&newValue)) {
+			cache.notifyRemoval(key, newValue, REPLACED)
+			return newValue
+		}
+		cache.afterWrite(entry, p, newValue, now)
+		return newValue
+	}
+
+	// 没有值的 entry 可能已经从 dirty 中删除，需要加锁后在 read 或者 dirty 中的 entry 上写入
+	cache.mu.Lock()
+	entry = cache.getOrCreateEntryLocked(key)
+	stored := atomic.CompareAndSwapPointer(&entry.p, nil, unsafe.Pointer(&newValue))
+	cache.mu.Unlock()
+	if !stored {
+		cache.notifyRemoval(key, newValue, REPLACED)
+		return newValue
+	}
+	cache.afterWrite(entry, nil, newValue, now)
+	return newValue
+}
+
+// getOrCreateEntryLocked 返回 key 对应的未被标记为 expunged 的 entry，不存在时创建一个值为 nil 的 entry
+func (cache *LocalCache) getOrCreateEntryLocked(key interface{}) *referenceEntry {
+	read, _ := cache.read.Load().(readOnly)
+	if entry, ok := read.m[key]; ok {
+		if entry.unexpungeLocked() {
+			cache.dirty[key] = entry
+		}
+		return entry
+	}
+	if entry, ok := cache.dirty[key]; ok {
+		return entry
+	}
+	if !read.amended {
+		cache.dirtyLocked()
+		cache.read.Store(readOnly{m: read.m, amended: true})
+	}
+	entry := &referenceEntry{key: key}
+	cache.dirty[key] = entry
+	return entry
+}
+
+// keyLock 串行化同一个 key 的 compute
+type keyLock struct {
+	mu   sync.Mutex
+	refs int // 持有及等待锁的 goroutine 数量，受 LocalCache.computingMu 保护
+}
+
+// lockKey 获取 key 的锁，remapping 中不能再 compute 同一个 key
+func (cache *LocalCache) lockKey(key interface{}) *keyLock {
+	cache.computingMu.Lock()
+	lock, ok := cache.computing[key]
+	if !ok {
+		if cache.computing == nil {
+			cache.computing = make(map[interface{}]*keyLock)
+		}
+		lock = &keyLock{}
+		cache.computing[key] = lock
+	}
+	lock.refs++
+	cache.computingMu.Unlock()
+
+	lock.mu.Lock()
+	return lock
+}
+
+func (cache *LocalCache) unlockKey(key interface{}, lock *keyLock) {
+	lock.mu.Unlock()
+
+	cache.computingMu.Lock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(cache.computing, key)
+	}
+	cache.computingMu.Unlock()
+}
@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vvwyy/peanut/common/clock/clocktest"
+)
+
+func TestLocalCache_Compute(t *testing.T) {
+	recorder := &notificationRecorder{}
+	cache := NewBuilder().
+		RemovalListener(recorder.onRemoval).
+		Build(nil).(*LocalCache)
+
+	increment := func(key, oldValue interface{}) interface{} {
+		if oldValue == nil {
+			return 1
+		}
+		return oldValue.(int) + 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cache.Compute("counter", increment)
+				cache.Merge("merged", 1, func(oldValue, value interface{}) interface{} {
+					return oldValue.(int) + value.(int)
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	if cache.GetIfPresent("counter") != 10000 || cache.GetIfPresent("merged") != 10000 {
+		t.Fatalf("lost updates: %v, %v", cache.GetIfPresent("counter"), cache.GetIfPresent("merged"))
+	}
+
+	// 返回 nil 时删除
+	if cache.Compute("counter", func(key, oldValue interface{}) interface{} { return nil }) != nil {
+		t.FailNow()
+	}
+	if cache.GetIfPresent("counter") != nil {
+		t.FailNow()
+	}
+	if cache.ComputeIfPresent("counter", increment) != nil || cache.GetIfPresent("counter") != nil {
+		t.FailNow()
+	}
+
+	if cache.ComputeIfAbsent("a", func(key interface{}) interface{} { return "a1" }) != "a1" {
+		t.FailNow()
+	}
+	if cache.ComputeIfAbsent("a", func(key interface{}) interface{} { return "a2" }) != "a1" {
+		t.FailNow()
+	}
+	if cache.ComputeIfPresent("a", func(key, oldValue interface{}) interface{} { return "a3" }) != "a3" {
+		t.FailNow()
+	}
+	if cache.ComputeIfPresent("a", func(key, oldValue interface{}) interface{} { return nil }) != nil {
+		t.FailNow()
+	}
+
+	causes := recorder.causes()
+	if causes[10000] != EXPLICIT || causes["a1"] != REPLACED || causes["a3"] != EXPLICIT {
+		t.Fatalf("unexpected causes: %v", causes)
+	}
+}
+
+func TestLocalCache_ComputeExpired(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	recorder := &notificationRecorder{}
+	cache := NewBuilder().
+		ExpireAfterWrite(100 * time.Millisecond).
+		RemovalListener(recorder.onRemoval).
+		Clock(fakeClock).
+		Build(nil).(*LocalCache)
+
+	cache.Put("a", "a1")
+	cache.Put("b", "b1")
+	fakeClock.Advance(150 * time.Millisecond)
+
+	// 过期的值视为不存在
+	if cache.ComputeIfAbsent("a", func(key interface{}) interface{} { return "a2" }) != "a2" {
+		t.FailNow()
+	}
+	if cache.ComputeIfPresent("b", func(key, oldValue interface{}) interface{} { return "b2" }) != nil {
+		t.FailNow()
+	}
+	if cache.Compute("b", func(key, oldValue interface{}) interface{} { return nil }) != nil {
+		t.FailNow()
+	}
+
+	// 写入后重新计算过期时间
+	fakeClock.Advance(50 * time.Millisecond)
+	if cache.GetIfPresent("a") != "a2" {
+		t.FailNow()
+	}
+
+	causes := recorder.causes()
+	if causes["a1"] != EXPIRED || causes["b1"] != EXPIRED {
+		t.Fatalf("unexpected causes: %v", causes)
+	}
+}
+
+func TestLocalCache_ComputeOnce(t *testing.T) {
+	cache := NewBuilder().Build(nil).(*LocalCache)
+
+	var calls int32
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value := cache.ComputeIfAbsent("a", func(key interface{}) interface{} {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(time.Millisecond)
+				return "a1"
+			})
+			if value != "a1" {
+				t.Errorf("unexpected value %v", value)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Fatalf("mapping should be called once, got %d", calls)
+	}
+
+	// 与 Put 并发时 remapping 同样只调用一次
+	calls = 0
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cache.Compute("b", func(key, oldValue interface{}) interface{} {
+				atomic.AddInt32(&calls, 1)
+				return "b1"
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			cache.Put("b", "b2")
+		}()
+	}
+	wg.Wait()
+	if calls != 100 {
+		t.Fatalf("remapping should be called 100 times, got %d", calls)
+	}
+}
+
+func TestLocalCache_ComputeRacingDelete(t *testing.T) {
+	recorder := &notificationRecorder{}
+	cache := NewBuilder().
+		RemovalListener(recorder.onRemoval).
+		Build(nil).(*LocalCache)
+
+	const n = 2000
+	computed := make([]interface{}, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		// 新写入的 key 只在 dirty 中
+		cache.Put(i, "old")
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cache.Delete(i)
+		}()
+		go func() {
+			defer wg.Done()
+			computed[i] = cache.Compute(i, func(key, oldValue interface{}) interface{} {
+				return key
+			})
+		}()
+	}
+	wg.Wait()
+
+	// 计算出的值要么还在缓存中，要么随后被删除或者替换并收到通知
+	removed := make(map[interface{}]bool)
+	recorder.mu.Lock()
+	for _, notification := range recorder.notifications {
+		removed[notification.Value] = true
+	}
+	recorder.mu.Unlock()
+	for i := 0; i < n; i++ {
+		if computed[i] != i {
+			t.Fatalf("unexpected computed value %v for %d", computed[i], i)
+		}
+		if cache.GetIfPresent(i) != i && !removed[i] {
+			t.Fatalf("computed value of %d is lost", i)
+		}
+	}
+	if cache.EstimatedSize() != cache.Size() {
+		t.Fatalf("estimated size %d, size %d", cache.EstimatedSize(), cache.Size())
+	}
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"sync/atomic"
+)
+
+// PutIfAbsent key 不存在（包括已过期）时写入 value；已存在时不修改，返回已存在的值及 true
+func (cache *LocalCache) PutIfAbsent(key, value interface{}) (existing interface{}, loaded bool) {
+	current := cache.compute(key, func(oldValue interface{}, present bool) (interface{}, bool) {
+		loaded = present
+		return value, !present
+	})
+	if !loaded {
+		return nil, false
+	}
+	return current, true
+}
+
+// Replace key 存在时将其值替换为 value，返回被替换的值及 true；不存在时不写入
+func (cache *LocalCache) Replace(key, value interface{}) (previous interface{}, replaced bool) {
+	cache.compute(key, func(oldValue interface{}, present bool) (interface{}, bool) {
+		previous, replaced = oldValue, present
+		return value, present
+	})
+	if !replaced {
+		return nil, false
+	}
+	return previous, true
+}
+
+// CompareAndSwap key 的值等于 old 时替换为 new，old 必须是可比较的
+func (cache *LocalCache) CompareAndSwap(key, old, new interface{}) (swapped bool) {
+	cache.compute(key, func(oldValue interface{}, present bool) (interface{}, bool) {
+		swapped = present && oldValue == old
+		return new, swapped
+	})
+	return swapped
+}
+
+// CompareAndDelete key 的值等于 old 时删除，old 必须是可比较的
+func (cache *LocalCache) CompareAndDelete(key, old interface{}) (deleted bool) {
+	entry, ok := cache.getEntry(key)
+	if !ok {
+		return false
+	}
+	now := cache.now()
+	for {
+		p := atomic.LoadPointer(&entry.p)
+		if p == nil || p == expunged || *(*interface{})(p) != old || cache.isExpired(entry, now) {
+			return false
+		}
+		if atomic.CompareAndSwapPointer(&entry.p, p, nil) {
+			cache.discard(entry)
+			cache.notifyRemoval(key, old, EXPLICIT)
+			return true
+		}
+	}
+}
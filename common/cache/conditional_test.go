@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vvwyy/peanut/common/clock/clocktest"
+)
+
+func TestLocalCache_PutIfAbsent(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache := NewBuilder().
+		ExpireAfterWrite(100 * time.Millisecond).
+		Clock(fakeClock).
+		Build(nil).(*LocalCache)
+
+	if existing, loaded := cache.PutIfAbsent("a", "a1"); loaded || existing != nil {
+		t.FailNow()
+	}
+	if existing, loaded := cache.PutIfAbsent("a", "a2"); !loaded || existing != "a1" {
+		t.FailNow()
+	}
+
+	// 过期的值视为不存在
+	fakeClock.Advance(150 * time.Millisecond)
+	if _, loaded := cache.PutIfAbsent("a", "a3"); loaded || cache.GetIfPresent("a") != "a3" {
+		t.FailNow()
+	}
+
+	// 并发时只有一个写入成功
+	var stored int32
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, loaded := cache.PutIfAbsent("b", i); !loaded {
+				atomic.AddInt32(&stored, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if stored != 1 {
+		t.Fatalf("expected 1 store, got %d", stored)
+	}
+}
+
+func TestLocalCache_Replace(t *testing.T) {
+	recorder := &notificationRecorder{}
+	cache := NewBuilder().
+		RemovalListener(recorder.onRemoval).
+		Build(nil).(*LocalCache)
+
+	if _, replaced := cache.Replace("a", "a1"); replaced || cache.GetIfPresent("a") != nil {
+		t.FailNow()
+	}
+	cache.Put("a", "a1")
+	if previous, replaced := cache.Replace("a", "a2"); !replaced || previous != "a1" {
+		t.FailNow()
+	}
+
+	if cache.CompareAndSwap("a", "a1", "a3") || cache.GetIfPresent("a") != "a2" {
+		t.FailNow()
+	}
+	if !cache.CompareAndSwap("a", "a2", "a3") || cache.GetIfPresent("a") != "a3" {
+		t.FailNow()
+	}
+	if cache.CompareAndSwap("b", nil, "b1") {
+		t.FailNow()
+	}
+
+	if cache.CompareAndDelete("a", "a2") || cache.GetIfPresent("a") != "a3" {
+		t.FailNow()
+	}
+	if !cache.CompareAndDelete("a", "a3") || cache.GetIfPresent("a") != nil {
+		t.FailNow()
+	}
+
+	causes := recorder.causes()
+	if causes["a1"] != REPLACED || causes["a2"] != REPLACED || causes["a3"] != EXPLICIT {
+		t.Fatalf("unexpected causes: %v", causes)
+	}
+}
@@ -0,0 +1,10 @@
+package cache
+
+import "errors"
+
+var (
+	NoLoaderError = errors.New("cache has no loader")
+	// Loader 返回 NotFoundError (或者包装了它的错误) 表示 key 对应的值不存在，
+	// 设置 Builder.CacheErrors 后会被缓存；GetAll 中不存在的 key 不会出现在结果中
+	NotFoundError = errors.New("cache: value not found")
+)
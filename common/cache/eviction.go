@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"container/list"
+)
+
+// 容量淘汰策略：记录 entry 的访问和写入，容量（entry 权重之和）超出时选出需要淘汰的 entry
+//
+// entry.weight 由策略维护，受策略的锁保护；
+// 策略有自己的锁，不会获取 LocalCache.mu，所以可以在持有 LocalCache.mu 时调用
+type evictionPolicy interface {
+	// 记录一次读命中，锁竞争时允许丢弃
+	recordAccess(entry *referenceEntry)
+	// 记录一次写入（新增或者更新）及写入后 entry 的权重，返回需要被淘汰的 entry；
+	// 值在记录之前已经被删除的 entry 不再加入策略，否则其 remove 可能早于 recordWrite
+	recordWrite(entry *referenceEntry, weight int64) (victims []*referenceEntry)
+	// entry 被删除或者过期时移除
+	remove(entry *referenceEntry)
+}
+
+// 最近最少使用 (LRU) 淘汰策略
+type lruPolicy struct {
+	mu Mutex // protects following fields
+
+	capacity     int64
+	weightedSize int64
+	order        *list.List // 表头为最近使用，表尾为最久未使用
+	nodes        map[*referenceEntry]*list.Element
+}
+
+func newLRUPolicy(capacity int64) *lruPolicy {
+	return &lruPolicy{
+		capacity: capacity,
+		order:    list.New(),
+		nodes:    make(map[*referenceEntry]*list.Element),
+	}
+}
+
+func (policy *lruPolicy) recordAccess(entry *referenceEntry) {
+	if !policy.mu.TryLock() { // NOTE: 读操作只尝试记录访问顺序，不做强制
+		return
+	}
+	if node, ok := policy.nodes[entry]; ok {
+		policy.order.MoveToFront(node)
+	}
+	policy.mu.Unlock()
+}
+
+func (policy *lruPolicy) recordWrite(entry *referenceEntry, weight int64) (victims []*referenceEntry) {
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+
+	if _, ok := entry.load(); !ok {
+		return nil
+	}
+	if weight > policy.capacity {
+		// 超过最大权重的 entry 只淘汰其自身，不挤掉其它 entry
+		if node, ok := policy.nodes[entry]; ok {
+			policy.order.Remove(node)
+			delete(policy.nodes, entry)
+			policy.weightedSize -= entry.weight
+		}
+		return []*referenceEntry{entry}
+	}
+
+	if node, ok := policy.nodes[entry]; ok {
+		policy.weightedSize += weight - entry.weight
+		policy.order.MoveToFront(node)
+	} else {
+		policy.weightedSize += weight
+		policy.nodes[entry] = policy.order.PushFront(entry)
+	}
+	entry.weight = weight
+
+	for policy.weightedSize > policy.capacity {
+		node := policy.order.Back()
+		victim := node.Value.(*referenceEntry)
+		policy.order.Remove(node)
+		delete(policy.nodes, victim)
+		policy.weightedSize -= victim.weight
+		victims = append(victims, victim)
+	}
+	return victims
+}
+
+func (policy *lruPolicy) remove(entry *referenceEntry) {
+	policy.mu.Lock()
+	if node, ok := policy.nodes[entry]; ok {
+		policy.order.Remove(node)
+		delete(policy.nodes, entry)
+		policy.weightedSize -= entry.weight
+	}
+	policy.mu.Unlock()
+}
@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestLocalCache_MaximumSize(t *testing.T) {
+	cache := NewBuilder().
+		MaximumSize(3).
+		Build(nil)
+
+	cache.Put(1, 1)
+	cache.Put(2, 2)
+	cache.Put(3, 3)
+
+	// 访问 1，使 2 成为最久未使用的 entry
+	if cache.GetIfPresent(1) != 1 {
+		t.FailNow()
+	}
+
+	cache.Put(4, 4)
+
+	if cache.GetIfPresent(2) != nil {
+		t.Logf("least recently used entry should be evicted")
+		t.FailNow()
+	}
+	for _, key := range []int{1, 3, 4} {
+		if cache.GetIfPresent(key) != key {
+			t.Logf("entry %d should be present", key)
+			t.FailNow()
+		}
+	}
+
+	// 删除后重新写入不应该超出容量
+	cache.Delete(1)
+	cache.Put(5, 5)
+	cache.Put(1, 1)
+	count := 0
+	cache.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	if count != 3 {
+		t.Logf("cache size should be 3, but %d", count)
+		t.FailNow()
+	}
+}
+
+func TestLocalCache_MaximumSizeConcurrent(t *testing.T) {
+	const size = 100
+
+	cache := NewBuilder().
+		MaximumSize(size).
+		Build(&StringLoader{prefix: "A"})
+
+	done := make(chan struct{})
+	for g := 0; g < 4; g++ {
+		go func(g int) {
+			for i := 0; i < 10000; i++ {
+				cache.Put(g*10000+i, i)
+				cache.GetIfPresent(g*10000 + i/2)
+			}
+			done <- struct{}{}
+		}(g)
+	}
+	for g := 0; g < 4; g++ {
+		<-done
+	}
+
+	count := 0
+	cache.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	if count > size {
+		t.Logf("cache size %d exceeds maximum size %d", count, size)
+		t.FailNow()
+	}
+}
+
+func TestLocalCache_WTinyLFU(t *testing.T) {
+	const size = 100
+
+	cache := NewBuilder().
+		MaximumSize(size).
+		EvictionPolicy(WTinyLFU).
+		Build(nil)
+
+	// 热点数据被多次访问
+	for round := 0; round < 5; round++ {
+		for key := 0; key < size/2; key++ {
+			if cache.GetIfPresent(key) == nil {
+				cache.Put(key, key)
+			}
+		}
+	}
+
+	// 一次性的扫描访问不应该挤掉热点数据
+	for key := size; key < 100*size; key++ {
+		cache.Put(key, key)
+	}
+
+	hits := 0
+	for key := 0; key < size/2; key++ {
+		if cache.GetIfPresent(key) != nil {
+			hits++
+		}
+	}
+	if hits < size/2*9/10 {
+		t.Logf("hot entries should survive the scan, but only %d hits", hits)
+		t.FailNow()
+	}
+
+	count := 0
+	cache.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	if count > size {
+		t.Logf("cache size %d exceeds maximum size %d", count, size)
+		t.FailNow()
+	}
+}
+
+type lengthWeigher struct{}
+
+func (weigher lengthWeigher) Weigh(key, value interface{}) int64 {
+	return int64(len(value.(string)))
+}
+
+func TestLocalCache_MaximumWeight(t *testing.T) {
+	for _, policy := range []Policy{LRU, WTinyLFU} {
+		cache := NewBuilder().
+			MaximumWeight(10).
+			Weigher(lengthWeigher{}).
+			EvictionPolicy(policy).
+			Build(nil)
+
+		cache.Put("a", "aaaa")
+		cache.Put("b", "bbbb")
+		cache.Put("c", "cc")
+
+		totalWeight := func() int {
+			weight := 0
+			cache.Range(func(key, value interface{}) bool {
+				weight += len(value.(string))
+				return true
+			})
+			return weight
+		}
+		if totalWeight() != 10 {
+			t.FailNow()
+		}
+
+		// 更新后权重变大，需要淘汰
+		cache.Put("c", "cccccc")
+		if weight := totalWeight(); weight > 10 {
+			t.Logf("total weight %d exceeds maximum weight 10", weight)
+			t.FailNow()
+		}
+
+		// 超过最大权重的 entry 不会被保留，也不会挤掉其它 entry
+		present := cache.Size()
+		cache.Put("d", "ddddddddddd")
+		if cache.GetIfPresent("d") != nil || totalWeight() > 10 {
+			t.FailNow()
+		}
+		if size := cache.Size(); size != present || cache.GetIfPresent("c") != "cccccc" {
+			t.Logf("other entries should survive an oversized entry, but size %d of %d", size, present)
+			t.FailNow()
+		}
+
+		// 更新后超过最大权重时只淘汰被更新的 entry
+		cache.Put("c", "ccccccccccc")
+		if cache.GetIfPresent("c") != nil || cache.Size() != present-1 {
+			t.FailNow()
+		}
+	}
+}
+
+// 并发的 Put 和 Delete 之后，淘汰策略中只能保留仍然存在的 entry
+func TestLocalCache_MaximumSizePutDelete(t *testing.T) {
+	for _, policy := range []Policy{LRU, WTinyLFU} {
+		cache := NewBuilder().
+			MaximumSize(1000).
+			EvictionPolicy(policy).
+			Build(nil).(*LocalCache)
+
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 20000; i++ {
+					if g%2 == 0 {
+						cache.Put(i%50, i)
+					} else {
+						cache.Delete(i % 50)
+					}
+					if i%16 == 0 {
+						runtime.Gosched()
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		var nodes int
+		switch p := cache.policy.(type) {
+		case *lruPolicy:
+			nodes = len(p.nodes)
+		case *tinyLFUPolicy:
+			nodes = len(p.nodes)
+		}
+		if size := cache.Size(); nodes != size {
+			t.Fatalf("policy %d tracks %d entries, but cache size is %d", policy, nodes, size)
+		}
+	}
+}
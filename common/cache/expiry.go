@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// NoExpiration 作为 Expiry 返回的时长或者 PutWithTTL 的 ttl 时表示 entry 不会过期
+const NoExpiration = time.Duration(math.MaxInt64)
+
+// Expiry 按 entry 计算过期时长，如根据值中的 token 有效期设置过期时间
+//
+// 返回的时长从当前时间开始计算，<= 0 表示立即过期，NoExpiration 表示不过期；
+// currentDuration 为 entry 当前剩余的时长，返回 currentDuration 表示不修改过期时间。
+// 设置 Expiry 后 ExpireAfterAccess 和 ExpireAfterWrite 不再生效。
+type Expiry interface {
+	// 新增 entry 后调用
+	ExpireAfterCreate(key, value interface{}) time.Duration
+	// 替换 entry 的值（包括刷新）后调用
+	ExpireAfterUpdate(key, value interface{}, currentDuration time.Duration) time.Duration
+	// 读命中后调用
+	ExpireAfterRead(key, value interface{}, currentDuration time.Duration) time.Duration
+}
+
+// PutWithTTL 写入 key 的值并设置 ttl 后过期，覆盖 ExpireAfterAccess、ExpireAfterWrite 以及 Expiry 计算的过期时间
+func (cache *LocalCache) PutWithTTL(key, value interface{}, ttl time.Duration) {
+	now := cache.now()
+	cache.invalidateLoading(key)
+	entry, previous := cache.store(key, &value)
+	cache.notifyReplaced(entry, previous, now)
+	entry.setExpireTime(expireTimeAfter(now, ttl))
+	cache.recordWrite(entry, value, now)
+	if previous == nil {
+		atomic.AddInt64(&cache.count, 1)
+	}
+}
+
+// expireAfterWrite 在写入后通过 Expiry 计算 entry 的过期时间，previous 为 nil 时表示新增
+func (cache *LocalCache) expireAfterWrite(entry *referenceEntry, previous unsafe.Pointer, value interface{}, now time.Duration) {
+	if cache.expiry == nil {
+		entry.setExpireTime(0)
+		return
+	}
+	var duration time.Duration
+	if previous == nil {
+		duration = cache.expiry.ExpireAfterCreate(entry.key, value)
+	} else {
+		duration = cache.expiry.ExpireAfterUpdate(entry.key, value, cache.remaining(entry, now))
+	}
+	entry.setExpireTime(expireTimeAfter(now, duration))
+}
+
+// expireAfterRead 在读命中后通过 Expiry 更新 entry 的过期时间
+func (cache *LocalCache) expireAfterRead(entry *referenceEntry, value interface{}, now time.Duration) {
+	if cache.expiry == nil {
+		return
+	}
+	current := cache.remaining(entry, now)
+	duration := cache.expiry.ExpireAfterRead(entry.key, value, current)
+	if duration == current {
+		return
+	}
+	previous := cache.deadline(entry)
+	entry.setExpireTime(expireTimeAfter(now, duration))
+	// 过期时间推后时由时间轮延迟调度，提前时需要重新放入时间轮
+	if deadline := cache.deadline(entry); cache.timers != nil && deadline > 0 && (previous == 0 || deadline < previous) {
+		cache.timers.schedule(entry)
+	}
+}
+
+// remaining 返回 entry 剩余的时长，不会过期时为 NoExpiration
+func (cache *LocalCache) remaining(entry *referenceEntry, now time.Duration) time.Duration {
+	deadline := cache.deadline(entry)
+	if deadline == 0 {
+		return NoExpiration
+	}
+	if deadline <= now {
+		return 0
+	}
+	return deadline - now
+}
+
+// expireTimeAfter 返回 duration 之后的时间，溢出或者为 NoExpiration 时返回 NoExpiration
+func expireTimeAfter(now, duration time.Duration) time.Duration {
+	if duration < 0 {
+		duration = 0
+	}
+	if duration > NoExpiration-now {
+		return NoExpiration
+	}
+	return now + duration
+}
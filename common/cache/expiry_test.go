@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vvwyy/peanut/common/clock/clocktest"
+)
+
+type token struct {
+	value string
+	ttl   time.Duration
+}
+
+// 按 token 的有效期过期，读取不影响过期时间
+type tokenExpiry struct{}
+
+func (expiry tokenExpiry) ExpireAfterCreate(key, value interface{}) time.Duration {
+	return value.(token).ttl
+}
+
+func (expiry tokenExpiry) ExpireAfterUpdate(key, value interface{}, currentDuration time.Duration) time.Duration {
+	return value.(token).ttl
+}
+
+func (expiry tokenExpiry) ExpireAfterRead(key, value interface{}, currentDuration time.Duration) time.Duration {
+	if value.(token).value == "once" {
+		return 0 // 只能读取一次
+	}
+	return currentDuration
+}
+
+func TestLocalCache_Expiry(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	recorder := &notificationRecorder{}
+	cache := NewBuilder().
+		ExpireAfterWrite(time.Hour). // 设置 Expiry 后不再生效
+		Expiry(tokenExpiry{}).
+		RemovalListener(recorder.onRemoval).
+		Clock(fakeClock).
+		Build(nil)
+
+	cache.Put("a", token{value: "a", ttl: 100 * time.Millisecond})
+	cache.Put("b", token{value: "b", ttl: time.Hour})
+	cache.Put("c", token{value: "c", ttl: NoExpiration})
+	cache.Put("d", token{value: "once", ttl: time.Hour})
+
+	if cache.GetIfPresent("d") == nil || cache.GetIfPresent("d") != nil {
+		t.Fatal("d should expire after the first read")
+	}
+
+	fakeClock.Advance(150 * time.Millisecond)
+	if cache.GetIfPresent("a") != nil {
+		t.Fatal("a should be expired")
+	}
+	if cache.GetIfPresent("b") == nil || cache.GetIfPresent("c") == nil {
+		t.FailNow()
+	}
+
+	// 更新时重新计算过期时间
+	cache.Put("b", token{value: "b", ttl: 50 * time.Millisecond})
+	fakeClock.Advance(100 * time.Millisecond)
+	cache.Cleanup()
+	if cache.GetIfPresent("b") != nil {
+		t.Fatal("b should be expired")
+	}
+
+	expired := make(map[string]bool)
+	for value, cause := range recorder.causes() {
+		if cause == EXPIRED {
+			expired[value.(token).value] = true
+		}
+	}
+	if !expired["a"] || !expired["b"] || !expired["once"] || expired["c"] {
+		t.Fatalf("unexpected expired tokens: %v", expired)
+	}
+}
+
+func TestLocalCache_PutWithTTL(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache := NewBuilder().
+		ExpireAfterWrite(100 * time.Millisecond).
+		Clock(fakeClock).
+		Build(nil).(*LocalCache)
+
+	cache.PutWithTTL("a", "a", 300*time.Millisecond)
+	cache.PutWithTTL("b", "b", 50*time.Millisecond)
+	cache.PutWithTTL("c", "c", NoExpiration)
+	cache.Put("d", "d")
+
+	fakeClock.Advance(70 * time.Millisecond)
+	if cache.GetIfPresent("b") != nil {
+		t.Fatal("b should be expired")
+	}
+
+	fakeClock.Advance(80 * time.Millisecond)
+	if cache.GetIfPresent("d") != nil {
+		t.Fatal("d should be expired")
+	}
+	if cache.GetIfPresent("a") != "a" || cache.GetIfPresent("c") != "c" {
+		t.FailNow()
+	}
+
+	// Put 之后恢复使用全局的过期时长
+	cache.Put("c", "c")
+	fakeClock.Advance(200 * time.Millisecond)
+	if cache.GetIfPresent("a") != nil || cache.GetIfPresent("c") != nil {
+		t.FailNow()
+	}
+}
+
+func TestLocalCache_FakeClock(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	recorder := &notificationRecorder{}
+	cache := NewBuilder().
+		ExpireAfterAccess(time.Minute).
+		ExpireAfterWrite(time.Hour).
+		Clock(fakeClock).
+		RemovalListener(recorder.onRemoval).
+		Build(nil).(*LocalCache)
+
+	cache.Put("a", "a")
+	cache.Put("b", "b")
+	cache.PutWithTTL("c", "c", 30*time.Second)
+
+	fakeClock.Advance(40 * time.Second)
+	if cache.GetIfPresent("c") != nil {
+		t.Fatal("c should be expired")
+	}
+	// 读取后 a 的访问过期时间重新开始计算
+	if cache.GetIfPresent("a") != "a" {
+		t.FailNow()
+	}
+
+	fakeClock.Advance(40 * time.Second)
+	cache.Cleanup()
+	if cache.GetIfPresent("a") != "a" || cache.GetIfPresent("b") != nil {
+		t.Fatal("b should expire after access")
+	}
+
+	// 持续访问也会在写入 ExpireAfterWrite 之后过期
+	for i := 0; i < 80; i++ {
+		fakeClock.Advance(50 * time.Second)
+		cache.GetIfPresent("a")
+	}
+	cache.Cleanup()
+	if cache.Size() != 0 {
+		t.Fatalf("expected empty cache, got %d entries", cache.Size())
+	}
+	for value, cause := range recorder.causes() {
+		if cause != EXPIRED {
+			t.Fatalf("unexpected cause %v for %v", cause, value)
+		}
+	}
+}
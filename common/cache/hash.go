@@ -0,0 +1,14 @@
+package cache
+
+import (
+	"hash/maphash"
+)
+
+var hashSeed = maphash.MakeSeed()
+
+// hashKey 计算 key 的哈希值，与 map 的 key 比较规则一致，相等的 key 哈希值一定相等
+//
+// key 必须是可比较的，与 map 的 key 的要求相同
+func hashKey(key interface{}) uint64 {
+	return maphash.Comparable(hashSeed, key)
+}
@@ -1,12 +1,49 @@
 package cache
 
-import "time"
+import (
+	"time"
+
+	"github.com/vvwyy/peanut/common/clock"
+	"github.com/vvwyy/peanut/concurrent"
+)
 
 type Builder struct {
 	expireAfterAccessDuration time.Duration
 	expireAfterWriteDuration  time.Duration
+	refreshAfterWriteDuration time.Duration
+	expiry                    Expiry
+
+	executor *concurrent.Executor
+
+	maximumSize   int64
+	maximumWeight int64
+	weigher       Weigher
+	policy        Policy
+
+	recordStats  bool
+	statsCounter StatsCounter
+
+	removalListener RemovalListener
+	removalExecutor *concurrent.Executor
+
+	cleanupInterval time.Duration
+
+	errorTTL     time.Duration
+	cachedErrors []error
+
+	concurrencyLevel int
+
+	clock clock.Clock
 }
 
+// 容量淘汰策略
+type Policy int
+
+const (
+	LRU      Policy = iota // 最近最少使用
+	WTinyLFU               // W-TinyLFU，适合有大量扫描访问的场景
+)
+
 func NewBuilder() *Builder {
 	return &Builder{
 		expireAfterAccessDuration: 0,
@@ -24,10 +61,154 @@ func (builder *Builder) ExpireAfterWrite(duration time.Duration) *Builder {
 	return builder
 }
 
-func (builder *Builder) Build(loader Loader) *LocalCache {
-	return &LocalCache{
+// Expiry 按 entry 计算过期时长，设置后 ExpireAfterAccess 和 ExpireAfterWrite 不再生效
+func (builder *Builder) Expiry(expiry Expiry) *Builder {
+	builder.expiry = expiry
+	return builder
+}
+
+// RefreshAfterWrite 写入超过 duration 后，下一次读取时在后台异步刷新，刷新期间返回旧值；
+// 刷新通过 loader 的 Reload (实现了 Reloader 时) 或 Load 进行，需要设置 loader
+func (builder *Builder) RefreshAfterWrite(duration time.Duration) *Builder {
+	builder.refreshAfterWriteDuration = duration
+	return builder
+}
+
+// Executor 设置执行刷新等异步任务的 executor
+func (builder *Builder) Executor(executor *concurrent.Executor) *Builder {
+	builder.executor = executor
+	return builder
+}
+
+// MaximumSize 限制缓存的最大 entry 数量，超出时按 EvictionPolicy 淘汰；size <= 0 表示不限制
+func (builder *Builder) MaximumSize(size int64) *Builder {
+	builder.maximumSize = size
+	return builder
+}
+
+// MaximumWeight 限制缓存中 entry 的权重之和，权重由 Weigher 计算，与 MaximumSize 互斥；
+// weight <= 0 表示不限制
+func (builder *Builder) MaximumWeight(weight int64) *Builder {
+	builder.maximumWeight = weight
+	return builder
+}
+
+func (builder *Builder) Weigher(weigher Weigher) *Builder {
+	builder.weigher = weigher
+	return builder
+}
+
+// EvictionPolicy 设置容量超出时的淘汰策略，默认为 LRU
+func (builder *Builder) EvictionPolicy(policy Policy) *Builder {
+	builder.policy = policy
+	return builder
+}
+
+// RecordStats 开启统计，通过 LocalCache.Stats 获取
+func (builder *Builder) RecordStats() *Builder {
+	builder.recordStats = true
+	return builder
+}
+
+// StatsCounter 开启统计并使用自定义的 StatsCounter 记录
+func (builder *Builder) StatsCounter(counter StatsCounter) *Builder {
+	builder.statsCounter = counter
+	return builder
+}
+
+// RemovalListener 设置 entry 被移除（删除、替换、过期、淘汰）时的回调
+func (builder *Builder) RemovalListener(listener RemovalListener) *Builder {
+	builder.removalListener = listener
+	return builder
+}
+
+// RemovalExecutor 设置后 RemovalListener 在 executor 中异步调用，否则同步调用
+func (builder *Builder) RemovalExecutor(executor *concurrent.Executor) *Builder {
+	builder.removalExecutor = executor
+	return builder
+}
+
+// CleanupInterval 设置后在后台每隔 interval 调用一次 LocalCache.Cleanup 移除过期的 entry，
+// 需要通过 LocalCache.Close 停止；不设置时过期的 entry 只在被访问到时标记删除
+func (builder *Builder) CleanupInterval(interval time.Duration) *Builder {
+	builder.cleanupInterval = interval
+	return builder
+}
+
+// CacheErrors 缓存加载错误 ttl 时长，期间 Get 直接返回该错误而不再调用 loader；
+// Loader 返回的 NotFoundError 总是会被缓存，errs 指定其它需要缓存的错误（通过 errors.Is 判断）。
+// 写入或者删除 key 时缓存的错误随之删除
+func (builder *Builder) CacheErrors(ttl time.Duration, errs ...error) *Builder {
+	builder.errorTTL = ttl
+	builder.cachedErrors = errs
+	return builder
+}
+
+// ConcurrencyLevel 将缓存分为 n 个独立加锁的 segment，适合频繁写入新 key 的场景；
+// 容量限制平均分配到每个 segment，BulkLoader.LoadAll 按 segment 分别调用。n <= 1 时不分段
+func (builder *Builder) ConcurrencyLevel(n int) *Builder {
+	builder.concurrencyLevel = n
+	return builder
+}
+
+// Clock 设置过期、加载耗时及后台清理使用的时钟，默认为 clock.System；
+// 测试中可以使用 clocktest.FakeClock 手动推进时间，不需要真实地等待 entry 过期
+func (builder *Builder) Clock(c clock.Clock) *Builder {
+	builder.clock = c
+	return builder
+}
+
+// Build 创建缓存，loader 为 nil 时 Get 退化为 GetIfPresent
+func (builder *Builder) Build(loader Loader) LoadingCache {
+	if builder.concurrencyLevel > 1 {
+		return newShardedCache(builder, loader)
+	}
+	return builder.build(loader)
+}
+
+func (builder *Builder) build(loader Loader) *LocalCache {
+	cache := &LocalCache{
 		expireAfterAccessDuration: builder.expireAfterAccessDuration,
 		expireAfterWriteDuration:  builder.expireAfterWriteDuration,
+		refreshAfterWriteDuration: builder.refreshAfterWriteDuration,
+		expiry:                    builder.expiry,
+		asyncExecutor:             builder.executor,
 		loader:                    loader,
+		statsCounter:              builder.statsCounter,
+		removalListener:           builder.removalListener,
+		removalExecutor:           builder.removalExecutor,
+		clock:                     clock.OrSystem(builder.clock),
+	}
+	if cache.statsCounter == nil && builder.recordStats {
+		cache.statsCounter = NewSimpleStatsCounter()
+	}
+	if builder.maximumWeight > 0 {
+		cache.policy = builder.newEvictionPolicy(builder.maximumWeight)
+		cache.weigher = builder.weigher
+	} else if builder.maximumSize > 0 {
+		cache.policy = builder.newEvictionPolicy(builder.maximumSize)
+	}
+	if builder.errorTTL > 0 {
+		cache.negative = NewBuilder().
+			ExpireAfterWrite(builder.errorTTL).
+			MaximumSize(builder.maximumSize).
+			CleanupInterval(builder.cleanupInterval).
+			Clock(cache.clock).
+			build(nil)
+		cache.cachedErrors = builder.cachedErrors
+	}
+	cache.timers = newTimerWheel(cache.now(), cache.deadline)
+	if builder.cleanupInterval > 0 {
+		cache.startCleanup(builder.cleanupInterval)
+	}
+	return cache
+}
+
+func (builder *Builder) newEvictionPolicy(capacity int64) evictionPolicy {
+	switch builder.policy {
+	case WTinyLFU:
+		return newTinyLFUPolicy(capacity)
+	default:
+		return newLRUPolicy(capacity)
 	}
 }
@@ -1,10 +1,14 @@
 package cache
 
 import (
+	"errors"
 	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
+
+	"github.com/vvwyy/peanut/common/clock"
+	"github.com/vvwyy/peanut/concurrent"
 )
 
 const mutexLocked = 1 << iota
@@ -36,10 +40,42 @@ type LocalCache struct {
 
 	loader Loader
 
+	loadingMu    sync.Mutex // protects loading
+	loading      map[interface{}]*loadingCall
+	loadingCount int32 // len(loading)，用于在没有加载时跳过 loadingMu
+
+	computingMu sync.Mutex // protects computing
+	computing   map[interface{}]*keyLock
+
+	reloadingMu sync.Mutex                            // protects reloading
+	reloading   map[*referenceEntry]concurrent.Future // 正在进行的刷新，Refresh 时共享
+
 	expireAfterAccessDuration time.Duration
 	expireAfterWriteDuration  time.Duration
+	refreshAfterWriteDuration time.Duration
+	expiry                    Expiry // 为 nil 时使用全局的过期时长
+
+	asyncExecutor *concurrent.Executor // 执行刷新等异步任务，为 nil 时使用 defaultExecutor
+
+	policy  evictionPolicy // 为 nil 时不限制容量
+	weigher Weigher        // 为 nil 时每个 entry 的权重为 1
+
+	negative     *LocalCache // 缓存加载错误，设置 Builder.CacheErrors 时才不为 nil
+	cachedErrors []error     // 除 NotFoundError 之外需要缓存的加载错误
+
+	timers  *timerWheel // 按过期时间索引 entry
+	removed int64       // 上一次 Cleanup 之后被删除的 entry 数量，原子读写
+	count   int64       // 有值的 entry 数量，包括已过期但还未被移除的，原子读写
 
-	//statsCounter SimpleStatsCounter
+	statsCounter StatsCounter
+
+	removalListener RemovalListener
+	removalExecutor *concurrent.Executor
+
+	clock clock.Clock // 过期、加载耗时及后台清理使用的时钟，通过 getClock 访问
+
+	closeOnce sync.Once
+	closed    chan struct{} // 关闭时停止后台清理，没有后台清理时为 nil
 }
 
 // entry 被清除后的标记 （read 中的数据不会被直接删除，而是先被标记为删除）
@@ -58,13 +94,24 @@ type readOnly struct {
 type referenceEntry struct {
 	p unsafe.Pointer // *interface{}
 
-	accessTime time.Duration // 记录 entry 最近一次被访问到时间
-	writeTime  time.Duration // 记录 entry 最近一次被写入的时间
+	key interface{}
+
+	accessTime time.Duration // 记录 entry 最近一次被访问到时间，原子读写
+	writeTime  time.Duration // 记录 entry 最近一次被写入的时间，原子读写
+	refreshing int32         // 为 1 时表示正在刷新
+
+	expireTime time.Duration // entry 的过期时间，为 0 时使用全局的过期时长，原子读写
+
+	weight int64 // entry 的权重，由 evictionPolicy 维护
+
+	timerPrev *referenceEntry // 时间轮 bucket 中的前后 entry，由 timerWheel 维护
+	timerNext *referenceEntry
 }
 
-func newEntry(val interface{}) *referenceEntry {
+func newEntry(key, val interface{}) *referenceEntry {
 	return &referenceEntry{
 		p:          unsafe.Pointer(&val),
+		key:        key,
 		accessTime: 0,
 		writeTime:  0,
 	}
@@ -86,181 +133,208 @@ func (cache *LocalCache) GetWithLoader(key interface{}, loader Loader) (interfac
 
 	read, _ := cache.read.Load().(readOnly)
 	if entry, ok := read.m[key]; ok {
-		now := time.Duration(time.Now().UnixNano())
+		now := cache.now()
 		value, ok := cache.getLiveValue(entry, now)
 		if ok {
-			cache.recordRead(entry, now)
+			cache.recordRead(entry, value, now)
+			cache.stats().RecordHits(1)
+			cache.refreshIfNeeded(entry, now, loader)
 			return value, nil
 		}
 	}
 
-	// locked GetOrLoad
-
-	cache.mu.Lock()
-	defer cache.mu.Unlock()
-	read, _ = cache.read.Load().(readOnly)
-
-	now := time.Duration(time.Now().UnixNano())
-
-	var actual interface{}
-	var existing bool
+	return cache.getOrLoad(key, loader)
+}
 
-	if entry, ok := read.m[key]; ok {
-		value, ok := entry.load()
-		if ok && !cache.isExpired(entry, now) {
-			actual, existing = value, true
-		} else {
-			if entry.unexpungeLocked() {
-				cache.dirty[key] = entry
-			}
+func (cache *LocalCache) GetIfPresent(key interface{}) interface{} { //(interface{}, bool) {
+	if value, ok := cache.getPresent(key); ok {
+		cache.stats().RecordHits(1)
+		return value //, true
+	}
 
-			// 通过 loader 获取新值
-			newValue, loadErr := loader.Load(key)
-			if nil != loadErr {
-				return nil, loadErr
-			}
+	cache.stats().RecordMisses(1)
+	return nil //, false
+}
 
-			entry.storeLocked(&newValue)
-			actual, existing = newValue, false
+// GetAll 获取多个 key 的值，返回的 map 中只包含存在的 key
+//
+// 未命中的 key 通过 loader 加载：loader 实现了 BulkLoader 时只调用一次 LoadAll，否则逐个调用 Load；
+// 没有设置 loader 时只返回已缓存的值。
+// 缓存的加载错误中只有 NotFoundError 表示 key 不存在，其它错误与 Get 一样返回
+func (cache *LocalCache) GetAll(keys []interface{}) (map[interface{}]interface{}, error) {
+	result := make(map[interface{}]interface{}, len(keys))
+	seen := make(map[interface{}]bool, len(keys))
+	var missing []interface{}
+	for _, key := range keys {
+		if seen[key] {
+			continue
 		}
-
-		if existing {
-			cache.recordRead(entry, now)
-		} else {
-			cache.recordWrite(entry, now)
+		seen[key] = true
+		if value, ok := cache.getPresent(key); ok {
+			result[key] = value
+		} else if err, ok := cache.getCachedError(key); !ok {
+			missing = append(missing, key)
+		} else if !errors.Is(err, NotFoundError) {
+			return nil, err
 		}
-	} else if entry, ok := cache.dirty[key]; ok {
-		value, ok := entry.load()
-		if ok && !cache.isExpired(entry, now) {
-			actual, existing = value, true
-		} else {
-			if entry.unexpungeLocked() {
-				cache.dirty[key] = entry
-			}
+	}
+	cache.stats().RecordHits(len(result))
+	if len(missing) == 0 {
+		return result, nil
+	}
 
-			// 通过 loader 获取新值
-			newValue, loadErr := loader.Load(key)
-			if nil != loadErr {
-				return nil, loadErr
-			}
+	loader := cache.loader
+	if loader == nil {
+		cache.stats().RecordMisses(len(missing))
+		return result, nil
+	}
 
-			entry.storeLocked(&newValue)
-			actual, existing = newValue, false
+	if bulkLoader, ok := loader.(BulkLoader); ok {
+		if err := cache.getAllOrLoad(missing, bulkLoader, result); err != nil {
+			return nil, err
 		}
+		return result, nil
+	}
 
-		if existing {
-			cache.recordRead(entry, now)
-		} else {
-			cache.recordWrite(entry, now)
-		}
-		cache.missLocked()
-	} else {
-		// 通过 loader 获取新值
-		newValue, loadErr := loader.Load(key)
-		if nil != loadErr {
-			return nil, loadErr
+	for _, key := range missing {
+		value, err := cache.getOrLoad(key, loader)
+		if errors.Is(err, NotFoundError) {
+			continue
 		}
-
-		if !read.amended {
-			cache.dirtyLocked()
-			cache.read.Store(readOnly{m: read.m, amended: true})
+		if err != nil {
+			return nil, err
 		}
-		newEntry := newEntry(newValue)
-		cache.dirty[key] = newEntry
-
-		cache.recordWrite(newEntry, now)
-		actual, existing = newValue, false
+		result[key] = value
 	}
-	//cache.mu.Unlock()
+	return result, nil
+}
 
-	return actual, nil
+// Stats 返回缓存统计数据的快照，未开启 Builder.RecordStats 时各项均为 0
+func (cache *LocalCache) Stats() CacheStats {
+	return cache.stats().Snapshot()
 }
 
-func (cache *LocalCache) GetIfPresent(key interface{}) interface{} { //(interface{}, bool) {
+func (cache *LocalCache) Put(key, value interface{}) {
+	now := cache.now()
+	cache.invalidateLoading(key)
+	entry, previous := cache.store(key, &value)
+	cache.afterWrite(entry, previous, value, now)
+}
+
+func (cache *LocalCache) Delete(key interface{}) {
+	cache.invalidateLoading(key)
 	read, _ := cache.read.Load().(readOnly)
 	entry, ok := read.m[key]
-
 	if !ok && read.amended {
 		cache.mu.Lock()
-		// 双检查，避免加锁的时候 dirty 提升为 read,这个时候 read 可能被替换了。
 		read, _ = cache.read.Load().(readOnly)
 		entry, ok = read.m[key]
 		if !ok && read.amended {
 			entry, ok = cache.dirty[key]
-			// 不管 dirty 中存不存在，都将misses计数加一
-			// missLocked() 中满足条件后就会提升m.dirty
-			cache.missLocked()
+			delete(cache.dirty, key)
 		}
 		cache.mu.Unlock()
 	}
-
 	if ok {
-		now := time.Duration(time.Now().UnixNano())
-		value, ok := cache.getLiveValue(entry, now)
-		if ok {
-			cache.recordRead(entry, now)
-			return value//, true
+		if value, deleted := entry.delete(); deleted {
+			cache.discard(entry)
+			cache.notifyRemoval(key, value, EXPLICIT)
 		}
 	}
-
-	return nil//, false
 }
 
-func (cache *LocalCache) Put(key, value interface{}) {
-	read, _ := cache.read.Load().(readOnly)
-	now := time.Duration(time.Now().UnixNano())
-	if entry, ok := read.m[key]; ok && entry.tryStore(&value) {
-		cache.recordWrite(entry, now)
-		return
+// Range 遍历未过期的 entry，f 返回 false 时停止遍历
+func (cache *LocalCache) Range(f func(key, value interface{}) bool) {
+	now := cache.now()
+	for k, e := range cache.entries() {
+		v, ok := e.load()
+		if !ok || cache.isExpired(e, now) {
+			continue
+		}
+		if !f(k, v) {
+			break
+		}
 	}
+}
 
-	// 元素不存在或者已经被标记为删除
-	cache.mu.Lock()
-	read, _ = cache.read.Load().(readOnly)
-	if entry, ok := read.m[key]; ok {
-		if entry.unexpungeLocked() {
-			// entry 已经被标记为删除，则表明 dirty != nil，并且 entry 不存在于 dirty 中
-			cache.dirty[key] = entry
+// Size 返回未过期的 entry 数量，是准确的值，需要遍历所有 entry
+func (cache *LocalCache) Size() int {
+	now := cache.now()
+	size := 0
+	for _, entry := range cache.entries() {
+		if _, ok := entry.load(); ok && !cache.isExpired(entry, now) {
+			size++
 		}
-		entry.storeLocked(&value)
+	}
+	return size
+}
 
-		cache.recordWrite(entry, now)
-	} else if entry, ok := cache.dirty[key]; ok {
-		entry.storeLocked(&value)
+// EstimatedSize 返回 entry 数量的估计值，O(1)；包括已过期但还未被移除的 entry
+func (cache *LocalCache) EstimatedSize() int {
+	return int(atomic.LoadInt64(&cache.count))
+}
 
-		cache.recordWrite(entry, now)
-	} else { // 新键值
-		if !read.amended { // dirty 中没有新的数据，往 dirty 中增加第一个新键
-			cache.dirtyLocked() // //从 read 中复制未删除的数据
-			cache.read.Store(readOnly{m: read.m, amended: true})
-		}
-		newEntry := newEntry(value)
-		cache.dirty[key] = newEntry
+// Keys 返回所有未过期的 key
+func (cache *LocalCache) Keys() []interface{} {
+	var keys []interface{}
+	cache.Range(func(key, value interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
 
-		cache.recordWrite(newEntry, now)
+// InvalidateKeys 删除 keys 对应的 entry
+func (cache *LocalCache) InvalidateKeys(keys []interface{}) {
+	for _, key := range keys {
+		cache.Delete(key)
 	}
-
-	cache.mu.Unlock()
 }
 
-func (cache *LocalCache) Delete(key interface{}) {
+// InvalidateAll 删除所有 entry，正在进行的加载结果也不会再写入缓存
+func (cache *LocalCache) InvalidateAll() {
+	now := cache.now()
+	cache.invalidateAllLoading()
+
+	var deleted []*referenceEntry
+	var values []interface{}
+	cache.mu.Lock()
 	read, _ := cache.read.Load().(readOnly)
-	entry, ok := read.m[key]
-	if !ok && read.amended {
-		cache.mu.Lock()
-		read, _ = cache.read.Load().(readOnly)
-		entry, ok = read.m[key]
-		if !ok && read.amended {
-			delete(cache.dirty, key)
+	m := read.m
+	if read.amended {
+		m = cache.dirty
+	}
+	live := make(map[interface{}]*referenceEntry)
+	for key, entry := range m {
+		if value, ok := entry.delete(); ok {
+			deleted = append(deleted, entry)
+			values = append(values, value)
+		}
+		// 删除之后被并发写入的 entry 保留
+		if !entry.tryExpungeLocked() {
+			live[key] = entry
 		}
-		cache.mu.Unlock()
 	}
-	if ok {
-		entry.delete()
+	cache.read.Store(readOnly{m: live})
+	cache.dirty = nil
+	cache.misses = 0
+	cache.mu.Unlock()
+
+	for i, entry := range deleted {
+		cache.discard(entry)
+		if cache.isExpired(entry, now) {
+			cache.stats().RecordEviction()
+			cache.notifyRemoval(entry.key, values[i], EXPIRED)
+		} else {
+			cache.notifyRemoval(entry.key, values[i], EXPLICIT)
+		}
 	}
 }
 
-func (cache *LocalCache) Range(f func(key, value interface{}) bool) {
+// ------------------------------------------------------
+
+// entries 返回包含所有 entry 的 map，返回的 map 不能修改
+func (cache *LocalCache) entries() map[interface{}]*referenceEntry {
 	// We need to be able to iterate over all of the keys that were already
 	// present at the start of the call to Range.
 	// If read.amended is false, then read.cache satisfies that property without
@@ -281,19 +355,145 @@ func (cache *LocalCache) Range(f func(key, value interface{}) bool) {
 		}
 		cache.mu.Unlock()
 	}
+	return read.m
+}
 
-	for k, e := range read.m {
-		v, ok := e.load()
-		if !ok {
-			continue
+// getPresent 获取 key 对应的未过期的值并记录访问，不记录统计
+func (cache *LocalCache) getPresent(key interface{}) (interface{}, bool) {
+	entry, ok := cache.getEntry(key)
+	if !ok {
+		return nil, false
+	}
+	now := cache.now()
+	value, ok := cache.getLiveValue(entry, now)
+	if !ok {
+		return nil, false
+	}
+	cache.recordRead(entry, value, now)
+	cache.refreshIfNeeded(entry, now, cache.loader)
+	return value, true
+}
+
+// getEntry 获取 key 对应的 entry，不检查 entry 是否有值或者过期
+func (cache *LocalCache) getEntry(key interface{}) (*referenceEntry, bool) {
+	read, _ := cache.read.Load().(readOnly)
+	entry, ok := read.m[key]
+
+	if !ok && read.amended {
+		cache.mu.Lock()
+		// 双检查，避免加锁的时候 dirty 提升为 read,这个时候 read 可能被替换了。
+		read, _ = cache.read.Load().(readOnly)
+		entry, ok = read.m[key]
+		if !ok && read.amended {
+			entry, ok = cache.dirty[key]
+			// 不管 dirty 中存不存在，都将misses计数加一
+			// missLocked() 中满足条件后就会提升m.dirty
+			cache.missLocked()
 		}
-		if !f(k, v) {
-			break
+		cache.mu.Unlock()
+	}
+	return entry, ok
+}
+
+// store 写入 key 的值，返回 key 对应的 entry 以及被替换的值（没有时为 nil）
+func (cache *LocalCache) store(key interface{}, i *interface{}) (*referenceEntry, unsafe.Pointer) {
+	read, _ := cache.read.Load().(readOnly)
+	if entry, ok := read.m[key]; ok {
+		if previous, ok := entry.trySwap(i); ok {
+			return entry, previous
 		}
 	}
+
+	// 元素不存在或者已经被标记为删除
+	cache.mu.Lock()
+	entry, previous := cache.storeLocked(key, i)
+	cache.mu.Unlock()
+	return entry, previous
 }
 
-// ------------------------------------------------------
+func (cache *LocalCache) storeLocked(key interface{}, i *interface{}) (*referenceEntry, unsafe.Pointer) {
+	read, _ := cache.read.Load().(readOnly)
+	if entry, ok := read.m[key]; ok {
+		if entry.unexpungeLocked() {
+			// entry 已经被标记为删除，则表明 dirty != nil，并且 entry 不存在于 dirty 中
+			cache.dirty[key] = entry
+		}
+		return entry, entry.swapLocked(i)
+	} else if entry, ok := cache.dirty[key]; ok {
+		return entry, entry.swapLocked(i)
+	}
+
+	// 新键值
+	if !read.amended { // dirty 中没有新的数据，往 dirty 中增加第一个新键
+		cache.dirtyLocked() // //从 read 中复制未删除的数据
+		cache.read.Store(readOnly{m: read.m, amended: true})
+	}
+	newEntry := newEntry(key, *i)
+	cache.dirty[key] = newEntry
+	return newEntry, nil
+}
+
+// afterWrite 在写入后（不持有 cache.mu）更新 entry 的状态，并通知被替换的值
+func (cache *LocalCache) afterWrite(entry *referenceEntry, previous unsafe.Pointer, value interface{}, now time.Duration) {
+	cache.notifyReplaced(entry, previous, now)
+	cache.expireAfterWrite(entry, previous, value, now)
+	cache.recordWrite(entry, value, now)
+	if previous == nil {
+		atomic.AddInt64(&cache.count, 1)
+	}
+}
+
+// notifyReplaced 通知被替换的值，需要在更新 entry 的时间之前调用
+func (cache *LocalCache) notifyReplaced(entry *referenceEntry, previous unsafe.Pointer, now time.Duration) {
+	if previous != nil {
+		cause := REPLACED
+		if cache.isExpired(entry, now) {
+			// 与 removeExpired 一样，过期的值被替换时同样计为一次淘汰
+			cause = EXPIRED
+			cache.stats().RecordEviction()
+		}
+		cache.notifyRemoval(entry.key, *(*interface{})(previous), cause)
+	}
+}
+
+// 零值的 LocalCache 也可以使用，此时不做统计
+func (cache *LocalCache) stats() StatsCounter {
+	if cache.statsCounter == nil {
+		return disabledStatsCounter{}
+	}
+	return cache.statsCounter
+}
+
+// getClock 返回缓存使用的时钟，零值的 LocalCache 没有设置 clock 时使用 clock.System
+func (cache *LocalCache) getClock() clock.Clock {
+	return clock.OrSystem(cache.clock)
+}
+
+// loadAll 通过 bulkLoader 一次加载多个 key，并记录未命中及加载耗时
+func (cache *LocalCache) loadAll(keys []interface{}, bulkLoader BulkLoader) (map[interface{}]interface{}, error) {
+	cache.stats().RecordMisses(len(keys))
+	start := cache.getClock().Now()
+	values, err := bulkLoader.LoadAll(keys)
+	if err != nil {
+		cache.stats().RecordLoadFailure(cache.getClock().Now().Sub(start))
+		return nil, err
+	}
+	cache.stats().RecordLoadSuccess(cache.getClock().Now().Sub(start))
+	return values, nil
+}
+
+// load 通过 loader 加载 key 对应的值，并记录未命中及加载耗时
+func (cache *LocalCache) load(key interface{}, loader Loader) (interface{}, error) {
+	cache.stats().RecordMisses(1)
+	start := cache.getClock().Now()
+	value, err := loader.Load(key)
+	if err != nil {
+		cache.stats().RecordLoadFailure(cache.getClock().Now().Sub(start))
+		return nil, err
+	}
+	cache.stats().RecordLoadSuccess(cache.getClock().Now().Sub(start))
+	return value, nil
+}
 
 func (cache *LocalCache) missLocked() {
 	cache.misses++
@@ -331,29 +531,83 @@ func (cache *LocalCache) getLiveValue(entry *referenceEntry, now time.Duration)
 	return value, true
 }
 
-func (cache *LocalCache) recordRead(entry *referenceEntry, now time.Duration) {
+func (cache *LocalCache) recordRead(entry *referenceEntry, value interface{}, now time.Duration) {
 	if cache.expiresAfterAccess() {
-		entry.accessTime = now
+		entry.setAccessTime(now)
+	}
+	cache.expireAfterRead(entry, value, now)
+	if cache.policy != nil {
+		cache.policy.recordAccess(entry)
 	}
 }
 
-func (cache *LocalCache) recordWrite(entry *referenceEntry, now time.Duration) {
+func (cache *LocalCache) recordWrite(entry *referenceEntry, value interface{}, now time.Duration) {
 	if cache.expiresAfterAccess() {
-		entry.accessTime = now
+		entry.setAccessTime(now)
 	}
-	if cache.expiresAfterWrite() {
-		entry.writeTime = now
+	if cache.expiresAfterWrite() || cache.refreshes() {
+		entry.setWriteTime(now)
+	}
+	if cache.timers != nil && cache.deadline(entry) > 0 {
+		cache.timers.schedule(entry) // 不再过期的 entry 在时间轮中到期时被丢弃
+	}
+	if cache.policy != nil {
+		for _, victim := range cache.policy.recordWrite(entry, cache.weigh(entry.key, value)) {
+			// 与过期一样只做删除标记，在 dirty 提升为 read 或者 Cleanup 时清理
+			if value, deleted := victim.delete(); deleted {
+				cache.discard(victim)
+				cache.stats().RecordEviction()
+				cache.notifyRemoval(victim.key, value, SIZE)
+			}
+		}
+	}
+}
+
+func (cache *LocalCache) weigh(key, value interface{}) int64 {
+	if cache.weigher == nil {
+		return 1
+	}
+	return cache.weigher.Weigh(key, value)
+}
+
+// discard 在 entry 的值被删除后调用，将 entry 移出淘汰策略和时间轮，每个被删除的值只能调用一次
+func (cache *LocalCache) discard(entry *referenceEntry) {
+	if cache.policy != nil {
+		cache.policy.remove(entry)
 	}
+	if cache.timers != nil {
+		cache.timers.deschedule(entry)
+	}
+	atomic.AddInt64(&cache.removed, 1)
+	atomic.AddInt64(&cache.count, -1)
 }
 
 func (cache *LocalCache) isExpired(entry *referenceEntry, now time.Duration) bool {
-	if cache.expiresAfterAccess() && (now-entry.accessTime >= cache.expireAfterAccessDuration) {
-		return true
+	deadline := cache.deadline(entry)
+	return deadline > 0 && now >= deadline
+}
+
+// deadline 返回 entry 的过期时间，为 0 时不会过期
+//
+// entry 设置了过期时间（Expiry 或者 PutWithTTL）时以其为准，否则按 ExpireAfterAccess、ExpireAfterWrite 计算
+func (cache *LocalCache) deadline(entry *referenceEntry) time.Duration {
+	if expireTime := entry.getExpireTime(); expireTime != 0 {
+		if expireTime == NoExpiration {
+			return 0
+		}
+		return expireTime
 	}
-	if cache.expiresAfterWrite() && (now-entry.writeTime >= cache.expireAfterWriteDuration) {
-		return true
+
+	var deadline time.Duration
+	if cache.expiresAfterAccess() {
+		deadline = entry.getAccessTime() + cache.expireAfterAccessDuration
+	}
+	if cache.expiresAfterWrite() {
+		if writeDeadline := entry.getWriteTime() + cache.expireAfterWriteDuration; deadline == 0 || writeDeadline < deadline {
+			deadline = writeDeadline
+		}
 	}
-	return false
+	return deadline
 }
 
 func (cache *LocalCache) expiresAfterAccess() bool {
@@ -365,19 +619,33 @@ func (cache *LocalCache) expiresAfterWrite() bool {
 }
 
 func (cache *LocalCache) tryExpireEntries(now time.Duration) {
-	if cache.mu.TryLock() { // NOTE: 这里只是尝试做过期标记，不做强制
-		cache.expireEntries(now)
-		cache.mu.Unlock()
+	if cache.timers == nil {
+		return
+	}
+	// NOTE: 这里只是尝试做过期标记，不做强制
+	if expired, ok := cache.timers.tryAdvance(now); ok {
+		cache.removeExpired(expired, now)
 	}
 }
 
 func (cache *LocalCache) expireEntries(now time.Duration) {
-	read, _ := cache.read.Load().(readOnly)
-	// 检查所有 entry，如果有过期的 entry，则进行过期标记
-	// NOTE: 这里不进行删除，删除只在 dirty 上升为 read 时进行
-	for _, entry := range read.m {
-		if cache.isExpired(entry, now) {
-			entry.delete()
+	if cache.timers == nil {
+		return
+	}
+	cache.removeExpired(cache.timers.advance(now), now)
+}
+
+// removeExpired 删除时间轮中取出的过期 entry
+// NOTE: 这里不从 map 中删除，删除在 dirty 提升为 read 或者 Cleanup 时进行
+func (cache *LocalCache) removeExpired(entries []*referenceEntry, now time.Duration) {
+	for _, entry := range entries {
+		if !cache.isExpired(entry, now) {
+			continue // 取出之后被重新写入，写入时已经重新放入时间轮
+		}
+		if value, deleted := entry.delete(); deleted {
+			cache.discard(entry)
+			cache.stats().RecordEviction()
+			cache.notifyRemoval(entry.key, value, EXPIRED)
 		}
 	}
 }
@@ -386,6 +654,30 @@ func (cache *LocalCache) expireEntries(now time.Duration) {
 // =========== reference entry
 // ========================================================================================================
 
+func (entry *referenceEntry) getAccessTime() time.Duration {
+	return time.Duration(atomic.LoadInt64((*int64)(&entry.accessTime)))
+}
+
+func (entry *referenceEntry) setAccessTime(now time.Duration) {
+	atomic.StoreInt64((*int64)(&entry.accessTime), int64(now))
+}
+
+func (entry *referenceEntry) getWriteTime() time.Duration {
+	return time.Duration(atomic.LoadInt64((*int64)(&entry.writeTime)))
+}
+
+func (entry *referenceEntry) setWriteTime(now time.Duration) {
+	atomic.StoreInt64((*int64)(&entry.writeTime), int64(now))
+}
+
+func (entry *referenceEntry) getExpireTime() time.Duration {
+	return time.Duration(atomic.LoadInt64((*int64)(&entry.expireTime)))
+}
+
+func (entry *referenceEntry) setExpireTime(expireTime time.Duration) {
+	atomic.StoreInt64((*int64)(&entry.expireTime), int64(expireTime))
+}
+
 func (entry *referenceEntry) load() (value interface{}, ok bool) {
 	p := atomic.LoadPointer(&entry.p)
 	if p == nil || p == expunged {
@@ -394,30 +686,27 @@ func (entry *referenceEntry) load() (value interface{}, ok bool) {
 	return *(*interface{})(p), true
 }
 
-func (entry *referenceEntry) tryStore(i *interface{}) bool {
-	p := atomic.LoadPointer(&entry.p)
-	if p == expunged {
-		return false
-	}
+// trySwap 在 entry 没有被标记为删除时替换值，返回被替换的值（已被删除时为 nil）
+func (entry *referenceEntry) trySwap(i *interface{}) (previous unsafe.Pointer, ok bool) {
 	for {
-		if atomic.CompareAndSwapPointer(&entry.p, p, unsafe.Pointer(i)) {
-			return true
-		}
-		p = atomic.LoadPointer(&entry.p)
+		p := atomic.LoadPointer(&entry.p)
 		if p == expunged {
-			return false
+			return nil, false
+		}
+		if atomic.CompareAndSwapPointer(&entry.p, p, unsafe.Pointer(i)) {
+			return p, true
 		}
 	}
 }
 
-func (entry *referenceEntry) delete() (hadValue bool) {
+func (entry *referenceEntry) delete() (value interface{}, hadValue bool) {
 	for {
 		p := atomic.LoadPointer(&entry.p)
 		if p == nil || p == expunged {
-			return false
+			return nil, false
 		}
 		if atomic.CompareAndSwapPointer(&entry.p, p, nil) { // CAS
-			return true
+			return *(*interface{})(p), true
 		}
 	}
 }
@@ -438,7 +727,7 @@ func (entry *referenceEntry) unexpungeLocked() (wasExpunged bool) {
 	return atomic.CompareAndSwapPointer(&entry.p, expunged, nil)
 }
 
-// 一定要保证 entry 没有被标记为删除
-func (entry *referenceEntry) storeLocked(i *interface{}) {
-	atomic.StorePointer(&entry.p, unsafe.Pointer(i))
+// 一定要保证 entry 没有被标记为删除，返回被替换的值（已被删除时为 nil）
+func (entry *referenceEntry) swapLocked(i *interface{}) unsafe.Pointer {
+	return atomic.SwapPointer(&entry.p, unsafe.Pointer(i))
 }
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"fmt"
+	"math/rand"
 	"reflect"
 	"sync/atomic"
 	"testing"
@@ -18,7 +19,7 @@ type bench struct {
 func benchMap(b *testing.B, bench bench) {
 
 	cache := NewBuilder().
-		Build(loader)
+		Build(loader).(*LocalCache)
 	b.Run(fmt.Sprintf("%T", cache), func(b *testing.B) {
 		cache = reflect.New(reflect.TypeOf(cache).Elem()).Interface().(*LocalCache)
 		if bench.setup != nil {
@@ -85,3 +86,104 @@ func BenchmarkAdversarialDelete(b *testing.B) {
 		},
 	})
 }
+
+// 命中率测试：热点数据服从 zipf 分布，穿插大量一次性的扫描访问
+//
+// 每个淘汰策略在各自的子测试中由固定的种子生成相同的访问序列，每次迭代用新的缓存重放整个序列
+func benchHitRate(b *testing.B, trace func() []int) {
+	const capacity = 1000
+
+	for _, policy := range []struct {
+		name   string
+		policy Policy
+	}{{"LRU", LRU}, {"WTinyLFU", WTinyLFU}} {
+		b.Run(policy.name, func(b *testing.B) {
+			keys := trace()
+
+			hits := 0
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cache := NewBuilder().
+					MaximumSize(capacity).
+					EvictionPolicy(policy.policy).
+					Build(nil)
+				hits = 0
+				for _, key := range keys {
+					if cache.GetIfPresent(key) != nil {
+						hits++
+					} else {
+						cache.Put(key, key)
+					}
+				}
+			}
+			b.ReportMetric(100*float64(hits)/float64(len(keys)), "hit%")
+		})
+	}
+}
+
+// 访问序列的长度
+const hitRateTraceLength = 1 << 18
+
+func BenchmarkHitRateZipf(b *testing.B) {
+	benchHitRate(b, func() []int {
+		zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.01, 1, 100000)
+		keys := make([]int, hitRateTraceLength)
+		for i := range keys {
+			keys[i] = int(zipf.Uint64())
+		}
+		return keys
+	})
+}
+
+func BenchmarkHitRateScan(b *testing.B) {
+	benchHitRate(b, func() []int {
+		zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.01, 1, 100000)
+		keys := make([]int, hitRateTraceLength)
+		for i := range keys {
+			// 每 4 次访问中有 1 次热点访问，3 次是从不重复的扫描访问
+			if i%4 == 0 {
+				keys[i] = int(zipf.Uint64())
+			} else {
+				keys[i] = -i
+			}
+		}
+		return keys
+	})
+}
+
+// 写多读少的场景：每次写入的都是新的 key，对比分段前后的性能
+func benchWriteHeavy(b *testing.B, writePercent int) {
+	for _, level := range []int{1, 16} {
+		b.Run(fmt.Sprintf("ConcurrencyLevel%d", level), func(b *testing.B) {
+			cache := NewBuilder().
+				ConcurrencyLevel(level).
+				Build(nil)
+
+			var seq int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(atomic.AddInt64(&seq, 1)))
+				for pb.Next() {
+					if r.Intn(100) < writePercent {
+						key := atomic.AddInt64(&seq, 1)
+						cache.Put(key, key)
+					} else {
+						cache.GetIfPresent(r.Int63n(atomic.LoadInt64(&seq) + 1))
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkWriteHeavy50(b *testing.B) {
+	benchWriteHeavy(b, 50)
+}
+
+func BenchmarkWriteHeavy90(b *testing.B) {
+	benchWriteHeavy(b, 90)
+}
+
+func BenchmarkWriteOnly(b *testing.B) {
+	benchWriteHeavy(b, 100)
+}
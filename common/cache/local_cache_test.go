@@ -7,6 +7,8 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/vvwyy/peanut/common/clock/clocktest"
 )
 
 type StringLoader struct {
@@ -15,16 +17,17 @@ type StringLoader struct {
 
 func (loader *StringLoader) Load(key interface{}) (interface{}, error) {
 	fmt.Printf("load from loader: %v \n", key)
-	time.Sleep(100*time.Millisecond)
 	return fmt.Sprintf("%s-%v", loader.prefix, key), nil
 }
 
 func TestLocalCache(t *testing.T) {
 
 	loader := &StringLoader{prefix: "A"}
+	fakeClock := clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
 
 	localCache := NewBuilder().
 		ExpireAfterWrite(3 * time.Second).
+		Clock(fakeClock).
 		Build(loader)
 
 	result := localCache.GetIfPresent("aaa")
@@ -45,7 +48,7 @@ func TestLocalCache(t *testing.T) {
 		t.FailNow()
 	}
 
-	time.Sleep(4 * time.Second)
+	fakeClock.Advance(4 * time.Second)
 
 	result = localCache.GetIfPresent("aaa")
 	if result != nil {
@@ -56,9 +59,11 @@ func TestLocalCache(t *testing.T) {
 func TestLocalCache1(t *testing.T) {
 
 	loader := &StringLoader{prefix: "A"}
+	fakeClock := clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
 
 	localCache := NewBuilder().
 		ExpireAfterWrite(3 * time.Second).
+		Clock(fakeClock).
 		Build(loader)
 
 	result, err := localCache.Get("aaa") // 调用 loader
@@ -85,7 +90,7 @@ func TestLocalCache1(t *testing.T) {
 		t.FailNow()
 	}
 
-	time.Sleep(4 * time.Second)
+	fakeClock.Advance(4 * time.Second)
 
 	result = localCache.GetIfPresent("aaa")
 	if result != nil {
@@ -96,9 +101,11 @@ func TestLocalCache1(t *testing.T) {
 func TestLocalCache2(t *testing.T) {
 
 	loader := &StringLoader{prefix: "A"}
+	fakeClock := clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
 
 	cache := NewBuilder().
 		ExpireAfterWrite(3 * time.Second).
+		Clock(fakeClock).
 		Build(loader)
 
 	cache.Put("B", "bbbbb")
@@ -116,7 +123,7 @@ func TestLocalCache2(t *testing.T) {
 		t.FailNow()
 	}
 
-	time.Sleep(3 * time.Second)
+	fakeClock.Advance(3 * time.Second)
 
 	result = cache.GetIfPresent("B")
 	if result != nil {
@@ -141,10 +148,12 @@ func TestLocalCache2(t *testing.T) {
 func TestLocalCache3(t *testing.T) {
 
 	loader := &StringLoader{prefix: "A"}
+	fakeClock := clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
 
 	cache := NewBuilder().
 		ExpireAfterWrite(30 * time.Second).
 		ExpireAfterAccess(2*time.Second).
+		Clock(fakeClock).
 		Build(loader)
 
 	cache.Put("B", "bbbbb")
@@ -162,7 +171,7 @@ func TestLocalCache3(t *testing.T) {
 		t.FailNow()
 	}
 
-	time.Sleep(2 * time.Second)
+	fakeClock.Advance(2 * time.Second)
 
 	result = cache.GetIfPresent("B")
 	if result != nil {
@@ -186,10 +195,12 @@ func TestLocalCache3(t *testing.T) {
 func TestLocalCache4(t *testing.T) {
 
 	loader := &StringLoader{prefix: "A"}
+	fakeClock := clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
 
 	cache := NewBuilder().
 		ExpireAfterWrite(3 * time.Second).
 		ExpireAfterAccess(10*time.Second).
+		Clock(fakeClock).
 		Build(loader)
 
 	cache.Put("B", "bbbbb")
@@ -207,7 +218,7 @@ func TestLocalCache4(t *testing.T) {
 		t.FailNow()
 	}
 
-	time.Sleep(3 * time.Second)
+	fakeClock.Advance(3 * time.Second)
 
 	result = cache.GetIfPresent("B")
 	if result != nil {
@@ -238,27 +249,33 @@ func TestLocalCache5(t *testing.T) {
 		Build(loader)
 
 	const size = 100000
+	var wg sync.WaitGroup
+	wg.Add(2)
 	go func() {
+		defer wg.Done()
 		for i := 0; i < size; i++ {
 			cache.Put(i, i)
 		}
 	}()
 
 	go func() {
+		defer wg.Done()
 		for i := 0; i < size; i++ {
 			cache.GetIfPresent(i)
 		}
 	}()
 
-	time.Sleep(time.Second*5)
+	wg.Wait()
 
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
 		for i := 0; i < size; i++ {
 			cache.Get(i)
 		}
 	}()
 
-	time.Sleep(time.Second * 5)
+	wg.Wait()
 }
 
 func TestLocalCache6(t *testing.T) {
@@ -273,27 +290,34 @@ func TestLocalCache6(t *testing.T) {
 	const size = 1000
 
 
+	var wg sync.WaitGroup
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
 		for i := 0; i < size; i++ {
 			cache.Put(i, i)
 		}
 	}()
 
 	for i:=0; i< size; i++ {
+		wg.Add(1)
 		go func() {
+			defer wg.Done()
 			cache.GetIfPresent(i)
 		}()
 	}
 
-	time.Sleep(time.Second*5)
+	wg.Wait()
 
 	for i:=0; i< size; i++ {
+		wg.Add(1)
 		go func() {
+			defer wg.Done()
 			cache.Get(i)
 		}()
 	}
 
-	time.Sleep(time.Second * 5)
+	wg.Wait()
 }
 
 func TestLocalCache7(t *testing.T) {
@@ -308,21 +332,26 @@ func TestLocalCache7(t *testing.T) {
 	const size = 1000
 
 
+	var wg sync.WaitGroup
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
 		for i := 0; i < size; i++ {
 			cache.Get(i)
 		}
 	}()
 
-	time.Sleep(time.Second*5)
+	wg.Wait()
 
 	for i:=0; i< size; i++ {
+		wg.Add(1)
 		go func() {
+			defer wg.Done()
 			cache.Get(i)
 		}()
 	}
 
-	time.Sleep(time.Second * 5)
+	wg.Wait()
 }
 
 func TestConcurrentRange(t *testing.T) {
@@ -390,9 +419,11 @@ func TestConcurrentRange(t *testing.T) {
 
 func TestLocalCache8(t *testing.T)  {
 	loader := &StringLoader{prefix: "A"}
+	fakeClock := clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
 	localCache := NewBuilder().
 		ExpireAfterAccess(5*time.Second).
-		Build(nil)
+		Clock(fakeClock).
+		Build(nil).(*LocalCache)
 
 	ret, err := localCache.GetWithLoader("1", loader)
 	if err != nil {
@@ -408,12 +439,275 @@ func TestLocalCache8(t *testing.T)  {
 	ret, err = localCache.GetWithLoader("1", loader)
 	t.Logf("【2】%v", ret)
 
-	time.Sleep(1*time.Second)
+	fakeClock.Advance(1*time.Second)
 	ret, err = localCache.GetWithLoader("1", loader)
 	t.Logf("【3】%v", ret)
 
-	time.Sleep(5*time.Second)
+	fakeClock.Advance(5*time.Second)
 
 	ret, err = localCache.GetWithLoader("1", loader)
 	t.Logf("【4】%v", ret)
-}
\ No newline at end of file
+}
+
+type countingLoader struct {
+	mu    sync.Mutex
+	loads map[interface{}]int
+	delay time.Duration
+}
+
+func (loader *countingLoader) Load(key interface{}) (interface{}, error) {
+	loader.mu.Lock()
+	if loader.loads == nil {
+		loader.loads = make(map[interface{}]int)
+	}
+	loader.loads[key]++
+	loader.mu.Unlock()
+	time.Sleep(loader.delay)
+	return fmt.Sprintf("loaded-%v", key), nil
+}
+
+func (loader *countingLoader) count(key interface{}) int {
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+	return loader.loads[key]
+}
+
+func TestLocalCache_SingleFlight(t *testing.T) {
+	loader := &countingLoader{delay: 200 * time.Millisecond}
+	cache := NewBuilder().Build(loader)
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := i % 2
+			value, err := cache.Get(key)
+			if err != nil || value != fmt.Sprintf("loaded-%v", key) {
+				t.Errorf("unexpected result %v, %v", value, err)
+			}
+		}(i)
+	}
+
+	// 加载期间不阻塞其它 key 的写入
+	cache.Put("other", "other")
+	if time.Since(start) >= loader.delay {
+		t.Errorf("Put should not wait for loading")
+	}
+	wg.Wait()
+
+	// 同一个 key 只加载一次，不同 key 并行加载
+	if loader.count(0) != 1 || loader.count(1) != 1 {
+		t.Logf("each key should be loaded once, but %d and %d times", loader.count(0), loader.count(1))
+		t.FailNow()
+	}
+	if elapsed := time.Since(start); elapsed >= 2*loader.delay {
+		t.Logf("loads of different keys should run in parallel, elapsed %v", elapsed)
+		t.FailNow()
+	}
+}
+
+func TestLocalCache_SingleFlightInvalidated(t *testing.T) {
+	loader := &countingLoader{delay: 200 * time.Millisecond}
+	cache := NewBuilder().Build(loader)
+
+	done := make(chan struct{})
+	go func() {
+		cache.Get("a")
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cache.Put("a", "put")
+	<-done
+
+	// 加载期间的 Put 不会被加载结果覆盖
+	if cache.GetIfPresent("a") != "put" {
+		t.FailNow()
+	}
+}
+
+type bulkStringLoader struct {
+	StringLoader
+	bulkLoads int
+}
+
+func (loader *bulkStringLoader) LoadAll(keys []interface{}) (map[interface{}]interface{}, error) {
+	loader.bulkLoads++
+	values := make(map[interface{}]interface{}, len(keys))
+	for _, key := range keys {
+		if key == "missing" {
+			continue
+		}
+		values[key] = fmt.Sprintf("%s-%v", loader.prefix, key)
+	}
+	return values, nil
+}
+
+func TestLocalCache_GetAll(t *testing.T) {
+	loader := &bulkStringLoader{StringLoader: StringLoader{prefix: "A"}}
+	cache := NewBuilder().Build(loader)
+	cache.Put("a", "cached")
+
+	values, err := cache.GetAll([]interface{}{"a", "b", "c", "b", "missing"})
+	if err != nil {
+		t.FailNow()
+	}
+	expected := map[interface{}]interface{}{"a": "cached", "b": "A-b", "c": "A-c"}
+	if len(values) != len(expected) {
+		t.Logf("unexpected values: %v", values)
+		t.FailNow()
+	}
+	for key, value := range expected {
+		if values[key] != value {
+			t.Logf("unexpected values: %v", values)
+			t.FailNow()
+		}
+	}
+	if loader.bulkLoads != 1 || cache.GetIfPresent("c") != "A-c" {
+		t.FailNow()
+	}
+
+	// 没有实现 BulkLoader 时逐个加载
+	cache = NewBuilder().Build(&StringLoader{prefix: "B"})
+	values, err = cache.GetAll([]interface{}{"a", "b"})
+	if err != nil || values["a"] != "B-a" || values["b"] != "B-b" {
+		t.FailNow()
+	}
+}
+
+// LoadAll 在 release 关闭之前阻塞
+type blockingBulkLoader struct {
+	StringLoader
+	started chan struct{}
+	release chan struct{}
+}
+
+func (loader *blockingBulkLoader) LoadAll(keys []interface{}) (map[interface{}]interface{}, error) {
+	close(loader.started)
+	<-loader.release
+	values := make(map[interface{}]interface{}, len(keys))
+	for _, key := range keys {
+		values[key] = "stale"
+	}
+	return values, nil
+}
+
+func TestLocalCache_GetAllInvalidated(t *testing.T) {
+	loader := &blockingBulkLoader{started: make(chan struct{}), release: make(chan struct{})}
+	cache := NewBuilder().Build(loader)
+
+	done := make(chan map[interface{}]interface{})
+	go func() {
+		values, _ := cache.GetAll([]interface{}{"a", "b"})
+		done <- values
+	}()
+
+	<-loader.started
+	cache.Put("a", "fresh")
+	close(loader.release)
+	values := <-done
+
+	// 加载期间的 Put 不会被加载结果覆盖，加载结果只返回给调用方
+	if values["a"] != "stale" || values["b"] != "stale" {
+		t.Fatalf("unexpected values: %v", values)
+	}
+	if cache.GetIfPresent("a") != "fresh" || cache.GetIfPresent("b") != "stale" {
+		t.FailNow()
+	}
+}
+
+func TestLocalCache_Size(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	var cache Cache = NewBuilder().
+		ExpireAfterWrite(100 * time.Millisecond).
+		Clock(fakeClock).
+		Build(nil)
+
+	cache.Put("a", "a")
+	cache.Put("b", "b")
+	cache.(ExpiringCache).PutWithTTL("c", "c", NoExpiration)
+	cache.Delete("b")
+	if cache.Size() != 2 {
+		t.FailNow()
+	}
+
+	fakeClock.Advance(150 * time.Millisecond)
+	if cache.Size() != 1 {
+		t.FailNow()
+	}
+}
+
+func TestLocalCache_Invalidate(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	recorder := &notificationRecorder{}
+	cache := NewBuilder().
+		ExpireAfterWrite(100 * time.Millisecond).
+		Clock(fakeClock).
+		RemovalListener(recorder.onRemoval).
+		Build(nil).(*LocalCache)
+
+	for i := 0; i < 10; i++ {
+		cache.Put(i, i)
+	}
+	cache.PutWithTTL("a", "a", NoExpiration)
+	if cache.Size() != 11 || cache.EstimatedSize() != 11 || len(cache.Keys()) != 11 {
+		t.FailNow()
+	}
+
+	cache.InvalidateKeys([]interface{}{0, 1, 2})
+	if cache.Size() != 8 || cache.EstimatedSize() != 8 {
+		t.FailNow()
+	}
+
+	// 过期的 entry 在被移除之前只计入 EstimatedSize
+	fakeClock.Advance(150 * time.Millisecond)
+	if cache.Size() != 1 || cache.EstimatedSize() != 8 {
+		t.FailNow()
+	}
+	keys := cache.Keys()
+	if len(keys) != 1 || keys[0] != "a" {
+		t.FailNow()
+	}
+	count := 0
+	cache.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	if count != 1 {
+		t.FailNow()
+	}
+
+	cache.InvalidateAll()
+	if cache.Size() != 0 || cache.EstimatedSize() != 0 || cache.GetIfPresent("a") != nil {
+		t.FailNow()
+	}
+	causes := recorder.causes()
+	if causes[0] != EXPLICIT || causes[9] != EXPIRED || causes["a"] != EXPLICIT {
+		t.Fatalf("unexpected causes: %v", causes)
+	}
+
+	cache.Put("b", "b")
+	if cache.GetIfPresent("b") != "b" || cache.EstimatedSize() != 1 {
+		t.FailNow()
+	}
+}
+
+// 零值的 LocalCache 没有设置 clock，需要可以直接使用
+func TestLocalCache_ZeroValue(t *testing.T) {
+	var cache LocalCache
+
+	cache.Put("a", "a")
+	if cache.GetIfPresent("a") != "a" {
+		t.FailNow()
+	}
+	value, err := cache.GetWithLoader("b", &StringLoader{prefix: "B"})
+	if err != nil || value != "B-b" {
+		t.Fatalf("unexpected value %v, err %v", value, err)
+	}
+	cache.Cleanup()
+	if cache.Size() != 2 {
+		t.FailNow()
+	}
+}
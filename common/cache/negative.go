@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"errors"
+)
+
+// getCachedError 返回 key 被缓存的加载错误
+func (cache *LocalCache) getCachedError(key interface{}) (error, bool) {
+	if cache.negative == nil {
+		return nil, false
+	}
+	if value := cache.negative.GetIfPresent(key); value != nil {
+		return value.(error), true
+	}
+	return nil, false
+}
+
+// cacheError 在 err 需要被缓存时记录 key 的加载错误，需要在持有 loadingMu 时调用以避免覆盖并发的写入
+func (cache *LocalCache) cacheError(key interface{}, err error) {
+	if cache.cachesError(err) {
+		cache.negative.Put(key, err)
+	}
+}
+
+func (cache *LocalCache) cachesError(err error) bool {
+	if cache.negative == nil {
+		return false
+	}
+	if errors.Is(err, NotFoundError) {
+		return true
+	}
+	for _, target := range cache.cachedErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetError 删除 key 被缓存的加载错误，在写入、删除 key 时调用
+func (cache *LocalCache) forgetError(key interface{}) {
+	if cache.negative != nil {
+		cache.negative.Delete(key)
+	}
+}
@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vvwyy/peanut/common/clock/clocktest"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+// 以 "missing" 开头的 key 不存在，以 "down" 开头的 key 加载失败，以 "bad" 开头的 key 返回不缓存的错误
+type rowLoader struct {
+	loads int32
+}
+
+func (loader *rowLoader) Load(key interface{}) (interface{}, error) {
+	atomic.AddInt32(&loader.loads, 1)
+	k := key.(string)
+	switch {
+	case len(k) >= 7 && k[:7] == "missing":
+		return nil, fmt.Errorf("row %s: %w", k, NotFoundError)
+	case len(k) >= 4 && k[:4] == "down":
+		return nil, errUnavailable
+	case len(k) >= 3 && k[:3] == "bad":
+		return nil, errors.New("bad key")
+	}
+	return k, nil
+}
+
+func TestLocalCache_CacheErrors(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	loader := &rowLoader{}
+	cache := NewBuilder().
+		CacheErrors(100*time.Millisecond, errUnavailable).
+		Clock(fakeClock).
+		Build(loader)
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Get("missing"); !errors.Is(err, NotFoundError) {
+			t.FailNow()
+		}
+		if _, err := cache.Get("down"); err != errUnavailable {
+			t.FailNow()
+		}
+		if _, err := cache.Get("bad"); err == nil {
+			t.FailNow()
+		}
+	}
+	// bad 的错误没有被缓存
+	if loads := atomic.LoadInt32(&loader.loads); loads != 5 {
+		t.Fatalf("expected 5 loads, got %d", loads)
+	}
+	if cache.GetIfPresent("missing") != nil {
+		t.FailNow()
+	}
+
+	// 写入后缓存的错误失效
+	cache.Put("down", "up")
+	if value, err := cache.Get("down"); err != nil || value != "up" {
+		t.FailNow()
+	}
+
+	// 超过 ttl 后重新加载
+	fakeClock.Advance(150 * time.Millisecond)
+	if _, err := cache.Get("missing"); !errors.Is(err, NotFoundError) {
+		t.FailNow()
+	}
+	if loads := atomic.LoadInt32(&loader.loads); loads != 6 {
+		t.Fatalf("expected 6 loads, got %d", loads)
+	}
+}
+
+type bulkRowLoader struct {
+	rowLoader
+	bulkLoads int32
+}
+
+func (loader *bulkRowLoader) LoadAll(keys []interface{}) (map[interface{}]interface{}, error) {
+	atomic.AddInt32(&loader.bulkLoads, 1)
+	values := make(map[interface{}]interface{})
+	for _, key := range keys {
+		if value, err := loader.Load(key); err == nil {
+			values[key] = value
+		}
+	}
+	return values, nil
+}
+
+func TestLocalCache_CacheErrorsGetAll(t *testing.T) {
+	loader := &bulkRowLoader{}
+	cache := NewBuilder().
+		CacheErrors(time.Minute).
+		Build(loader)
+
+	keys := []interface{}{"a", "missing1", "missing2"}
+	for i := 0; i < 2; i++ {
+		values, err := cache.GetAll(keys)
+		if err != nil || len(values) != 1 || values["a"] != "a" {
+			t.FailNow()
+		}
+	}
+	// 第二次调用时不存在的 key 不再加载
+	if loader.bulkLoads != 1 {
+		t.FailNow()
+	}
+	if _, err := cache.Get("missing1"); !errors.Is(err, NotFoundError) {
+		t.FailNow()
+	}
+
+	// 逐个加载时不存在的 key 同样不出现在结果中
+	perKey := NewBuilder().Build(&rowLoader{})
+	values, err := perKey.GetAll(keys)
+	if err != nil || len(values) != 1 {
+		t.FailNow()
+	}
+}
+
+func TestLocalCache_CacheErrorsGetAllFailed(t *testing.T) {
+	loader := &rowLoader{}
+	cache := NewBuilder().
+		CacheErrors(time.Minute, errUnavailable).
+		Build(loader)
+
+	// 缓存的加载错误与 Get 一样返回，不会被当作不存在的 key
+	for i := 0; i < 2; i++ {
+		if _, err := cache.GetAll([]interface{}{"down", "ok"}); err != errUnavailable {
+			t.Fatalf("unexpected err %v", err)
+		}
+	}
+	if loads := atomic.LoadInt32(&loader.loads); loads != 1 {
+		t.Fatalf("expected 1 load, got %d", loads)
+	}
+}
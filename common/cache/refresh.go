@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/vvwyy/peanut/concurrent"
+)
+
+// 没有通过 Builder.Executor 设置时，异步任务在这个 executor 中执行
+var defaultExecutor = concurrent.NewExecutor()
+
+// Refresh 异步重新加载 key 对应的值，返回加载结果的 Future
+//
+// 已有值时通过 Reloader.Reload (或 Load) 重新加载，加载期间仍然返回旧值；加载失败时保留旧值。
+// 已经有刷新在进行时返回其 Future，不再重复加载。
+// 没有值时与 Get 一样通过 Load 加载，并发的加载共享同一次 Load。没有设置 loader 时返回失败的 Future。
+func (cache *LocalCache) Refresh(key interface{}) concurrent.Future {
+	loader := cache.loader
+	if loader == nil {
+		return concurrent.NewFailedFuture(NoLoaderError)
+	}
+
+	if entry, ok := cache.getEntry(key); ok {
+		for {
+			if f, ok := cache.tryReload(entry, loader); ok {
+				if f != nil {
+					return f
+				}
+				break
+			}
+			if f := cache.getReloading(entry); f != nil {
+				return f
+			}
+			// 刷新刚刚开始，还没有登记 Future
+			runtime.Gosched()
+		}
+	}
+
+	return cache.executor().Go(func() (interface{}, error) {
+		return cache.getOrLoad(key, loader)
+	})
+}
+
+// refreshIfNeeded 在读命中时检查 entry 是否需要刷新，需要时在后台异步刷新，同一个 entry 同时只有一个刷新
+func (cache *LocalCache) refreshIfNeeded(entry *referenceEntry, now time.Duration, loader Loader) {
+	if !cache.refreshes() || loader == nil || now-entry.getWriteTime() < cache.refreshAfterWriteDuration {
+		return
+	}
+	cache.tryReload(entry, loader)
+}
+
+// tryReload 在 entry 没有正在进行的刷新时重新加载 entry 的值
+//
+// 已经有刷新在进行时返回 false；entry 的值已被删除时返回 nil, true
+func (cache *LocalCache) tryReload(entry *referenceEntry, loader Loader) (concurrent.Future, bool) {
+	if !atomic.CompareAndSwapInt32(&entry.refreshing, 0, 1) {
+		return nil, false
+	}
+	p := atomic.LoadPointer(&entry.p)
+	if p == nil || p == expunged {
+		atomic.StoreInt32(&entry.refreshing, 0)
+		return nil, true
+	}
+	return cache.reload(entry, p, loader), true
+}
+
+// reload 在 executor 中重新加载 entry 的值，entry 的值在加载期间被修改时丢弃加载结果
+//
+// 调用方需要先将 entry.refreshing 设为 1，加载结束后由 finishReloading 清除
+func (cache *LocalCache) reload(entry *referenceEntry, old unsafe.Pointer, loader Loader) concurrent.Future {
+	// 持有 reloadingMu 直到登记 Future，finishReloading 不会早于登记
+	cache.reloadingMu.Lock()
+	defer cache.reloadingMu.Unlock()
+
+	f := cache.executor().Go(func() (interface{}, error) {
+		defer cache.finishReloading(entry)
+
+		oldValue := *(*interface{})(old)
+		value, err := cache.reloadValue(entry.key, oldValue, loader)
+		if err != nil {
+			return nil, err
+		}
+
+		now := cache.now()
+		if atomic.CompareAndSwapPointer(&entry.p, old, unsafe.Pointer(&value)) {
+			cache.afterWrite(entry, old, value, now)
+		}
+		return value, nil
+	})
+	if cache.reloading == nil {
+		cache.reloading = make(map[*referenceEntry]concurrent.Future)
+	}
+	cache.reloading[entry] = f
+	return f
+}
+
+func (cache *LocalCache) getReloading(entry *referenceEntry) concurrent.Future {
+	cache.reloadingMu.Lock()
+	defer cache.reloadingMu.Unlock()
+	return cache.reloading[entry]
+}
+
+func (cache *LocalCache) finishReloading(entry *referenceEntry) {
+	cache.reloadingMu.Lock()
+	delete(cache.reloading, entry)
+	atomic.StoreInt32(&entry.refreshing, 0)
+	cache.reloadingMu.Unlock()
+}
+
+// reloadValue 通过 Reloader 或者 Loader 重新加载，并记录加载耗时
+func (cache *LocalCache) reloadValue(key, oldValue interface{}, loader Loader) (interface{}, error) {
+	start := cache.getClock().Now()
+	var value interface{}
+	var err error
+	if reloader, ok := loader.(Reloader); ok {
+		value, err = reloader.Reload(key, oldValue)
+	} else {
+		value, err = loader.Load(key)
+	}
+	if err != nil {
+		cache.stats().RecordLoadFailure(cache.getClock().Now().Sub(start))
+		return nil, err
+	}
+	cache.stats().RecordLoadSuccess(cache.getClock().Now().Sub(start))
+	return value, nil
+}
+
+func (cache *LocalCache) refreshes() bool {
+	return cache.refreshAfterWriteDuration > 0
+}
+
+func (cache *LocalCache) executor() *concurrent.Executor {
+	if cache.asyncExecutor == nil {
+		return defaultExecutor
+	}
+	return cache.asyncExecutor
+}
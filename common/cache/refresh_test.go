@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vvwyy/peanut/common/clock/clocktest"
+)
+
+type versionLoader struct {
+	version int32
+	fail    int32
+}
+
+func (loader *versionLoader) Load(key interface{}) (interface{}, error) {
+	return fmt.Sprintf("%v-%d", key, atomic.AddInt32(&loader.version, 1)), nil
+}
+
+func (loader *versionLoader) Reload(key, oldValue interface{}) (interface{}, error) {
+	if atomic.LoadInt32(&loader.fail) == 1 {
+		return nil, errors.New("reload failed")
+	}
+	time.Sleep(100 * time.Millisecond)
+	return fmt.Sprintf("%v-%d", key, atomic.AddInt32(&loader.version, 1)), nil
+}
+
+func TestLocalCache_RefreshAfterWrite(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	loader := &versionLoader{}
+	cache := NewBuilder().
+		RefreshAfterWrite(100 * time.Millisecond).
+		Clock(fakeClock).
+		Build(loader)
+
+	if value, _ := cache.Get("a"); value != "a-1" {
+		t.FailNow()
+	}
+
+	fakeClock.Advance(100 * time.Millisecond)
+
+	// 触发后台刷新，立即返回旧值
+	start := time.Now()
+	if value, _ := cache.Get("a"); value != "a-1" {
+		t.FailNow()
+	}
+	if time.Since(start) >= 100*time.Millisecond {
+		t.Logf("stale value should be returned without waiting for refresh")
+		t.FailNow()
+	}
+
+	// 等待后台刷新完成，时间不再推进，不会触发新的刷新
+	for deadline := time.Now().Add(5 * time.Second); cache.GetIfPresent("a") != "a-2"; {
+		if time.Now().After(deadline) {
+			t.Logf("value should be refreshed, but %v", cache.GetIfPresent("a"))
+			t.FailNow()
+		}
+		runtime.Gosched()
+	}
+	if value, _ := cache.Get("a"); value != "a-2" {
+		t.FailNow()
+	}
+}
+
+func TestLocalCache_Refresh(t *testing.T) {
+	loader := &versionLoader{}
+	cache := NewBuilder().Build(loader)
+
+	// 没有值时加载
+	if value, err := cache.Refresh("a").Get(); err != nil || value != "a-1" {
+		t.FailNow()
+	}
+	if cache.GetIfPresent("a") != "a-1" {
+		t.FailNow()
+	}
+
+	if value, err := cache.Refresh("a").Get(); err != nil || value != "a-2" {
+		t.FailNow()
+	}
+	if cache.GetIfPresent("a") != "a-2" {
+		t.FailNow()
+	}
+
+	// 刷新失败时保留旧值
+	atomic.StoreInt32(&loader.fail, 1)
+	if _, err := cache.Refresh("a").Get(); err == nil {
+		t.FailNow()
+	}
+	if cache.GetIfPresent("a") != "a-2" {
+		t.FailNow()
+	}
+
+	if _, err := NewBuilder().Build(nil).Refresh("a").Get(); err != NoLoaderError {
+		t.FailNow()
+	}
+}
+
+// Load 和 Reload 在 release 关闭之前阻塞
+type blockingReloader struct {
+	loads   int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func (loader *blockingReloader) Load(key interface{}) (interface{}, error) {
+	if atomic.AddInt32(&loader.loads, 1) == 1 {
+		close(loader.started)
+	}
+	<-loader.release
+	return "loaded", nil
+}
+
+func (loader *blockingReloader) Reload(key, oldValue interface{}) (interface{}, error) {
+	return loader.Load(key)
+}
+
+func TestLocalCache_RefreshInvalidated(t *testing.T) {
+	loader := &blockingReloader{started: make(chan struct{}), release: make(chan struct{})}
+	cache := NewBuilder().Build(loader)
+
+	future := cache.Refresh("a")
+	<-loader.started
+	cache.Put("a", "put")
+	close(loader.release)
+
+	// 加载期间的 Put 不会被加载结果覆盖
+	if value, err := future.Get(); err != nil || value != "loaded" {
+		t.FailNow()
+	}
+	if cache.GetIfPresent("a") != "put" {
+		t.FailNow()
+	}
+}
+
+func TestLocalCache_RefreshInProgress(t *testing.T) {
+	loader := &blockingReloader{started: make(chan struct{}), release: make(chan struct{})}
+	cache := NewBuilder().Build(loader)
+	cache.Put("a", "put")
+
+	first := cache.Refresh("a")
+	<-loader.started
+	// 刷新期间再次 Refresh 共享同一次加载
+	second := cache.Refresh("a")
+	close(loader.release)
+
+	if first != second {
+		t.Fatal("concurrent refreshes should share the same future")
+	}
+	if value, err := second.Get(); err != nil || value != "loaded" {
+		t.FailNow()
+	}
+	if loads := atomic.LoadInt32(&loader.loads); loads != 1 {
+		t.Fatalf("unexpected loads %d", loads)
+	}
+	if cache.GetIfPresent("a") != "loaded" {
+		t.FailNow()
+	}
+}
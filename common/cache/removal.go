@@ -0,0 +1,61 @@
+package cache
+
+// entry 被移除的原因
+type RemovalCause int
+
+const (
+	EXPLICIT  RemovalCause = iota // 被主动删除，如 Delete
+	REPLACED                      // 值被新的值替换，如对已存在的 key 调用 Put
+	EXPIRED                       // 超过 ExpireAfterAccess 或者 ExpireAfterWrite 的时长而过期
+	SIZE                          // 超过 MaximumSize 或者 MaximumWeight 而被淘汰
+	COLLECTED                     // 值被垃圾回收，当前没有弱引用的值，不会出现
+)
+
+func (cause RemovalCause) String() string {
+	switch cause {
+	case EXPLICIT:
+		return "EXPLICIT"
+	case REPLACED:
+		return "REPLACED"
+	case EXPIRED:
+		return "EXPIRED"
+	case SIZE:
+		return "SIZE"
+	case COLLECTED:
+		return "COLLECTED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// WasEvicted entry 是否是被自动移除的（而不是主动删除或者替换）
+func (cause RemovalCause) WasEvicted() bool {
+	return cause == EXPIRED || cause == SIZE || cause == COLLECTED
+}
+
+type RemovalNotification struct {
+	Key   interface{}
+	Value interface{}
+	Cause RemovalCause
+}
+
+// RemovalListener 在 entry 被移除时调用，可以用来释放缓存的值持有的资源
+//
+// 没有设置 executor 时在移除 entry 的 goroutine 中同步调用（不持有缓存的锁）
+type RemovalListener func(notification RemovalNotification)
+
+func (cache *LocalCache) notifyRemoval(key, value interface{}, cause RemovalCause) {
+	listener := cache.removalListener
+	if listener == nil {
+		return
+	}
+	notification := RemovalNotification{Key: key, Value: value, Cause: cause}
+	if cache.removalExecutor == nil {
+		listener(notification)
+		return
+	}
+	cache.removalExecutor.Go(func() (interface{}, error) {
+		listener(notification)
+		return nil, nil
+	})
+}
@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vvwyy/peanut/common/clock/clocktest"
+	"github.com/vvwyy/peanut/concurrent"
+)
+
+type notificationRecorder struct {
+	mu            sync.Mutex
+	notifications []RemovalNotification
+}
+
+func (recorder *notificationRecorder) onRemoval(notification RemovalNotification) {
+	recorder.mu.Lock()
+	recorder.notifications = append(recorder.notifications, notification)
+	recorder.mu.Unlock()
+}
+
+func (recorder *notificationRecorder) causes() map[interface{}]RemovalCause {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	causes := make(map[interface{}]RemovalCause)
+	for _, notification := range recorder.notifications {
+		causes[notification.Value] = notification.Cause
+	}
+	return causes
+}
+
+func TestLocalCache_RemovalListener(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	recorder := &notificationRecorder{}
+	cache := NewBuilder().
+		MaximumSize(2).
+		ExpireAfterWrite(200 * time.Millisecond).
+		RemovalListener(recorder.onRemoval).
+		Clock(fakeClock).
+		Build(&StringLoader{prefix: "A"})
+
+	cache.Put("a", "a1")
+	cache.Put("a", "a2") // REPLACED
+	cache.Delete("a")    // EXPLICIT
+	cache.Delete("a")    // 已删除，不再通知
+
+	cache.Put("b", "b1")
+	cache.Put("c", "c1")
+	cache.Put("d", "d1") // SIZE
+
+	fakeClock.Advance(200 * time.Millisecond)
+	cache.Put("d", "d2") // EXPIRED
+
+	expected := map[interface{}]RemovalCause{
+		"a1": REPLACED,
+		"a2": EXPLICIT,
+		"b1": SIZE,
+		"d1": EXPIRED,
+	}
+	causes := recorder.causes()
+	for value, cause := range expected {
+		if causes[value] != cause {
+			t.Logf("value %v should be removed with cause %v, but %v", value, cause, causes[value])
+			t.FailNow()
+		}
+	}
+	if len(recorder.notifications) != len(expected) {
+		t.Logf("unexpected notifications: %v", recorder.notifications)
+		t.FailNow()
+	}
+}
+
+func TestLocalCache_RemovalListenerExecutor(t *testing.T) {
+	recorder := &notificationRecorder{}
+	done := make(chan struct{}, 1)
+	cache := NewBuilder().
+		RemovalListener(func(notification RemovalNotification) {
+			recorder.onRemoval(notification)
+			done <- struct{}{}
+		}).
+		RemovalExecutor(concurrent.NewExecutor()).
+		Build(nil)
+
+	cache.Put("a", "a1")
+	cache.Delete("a")
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.FailNow()
+	}
+	if recorder.causes()["a1"] != EXPLICIT {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,225 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vvwyy/peanut/concurrent"
+)
+
+// shardedCache 由多个独立加锁的 LocalCache (segment) 组成，按 key 的哈希值选择 segment
+//
+// LocalCache 每写入一个新 key 都需要获取全局的锁，并且可能需要将 read 复制到 dirty；
+// 分段后新 key 的写入只会锁住一个 segment，适合频繁写入新 key 的场景。
+// 容量限制平均分配到每个 segment，淘汰在 segment 内进行。
+type shardedCache struct {
+	segments []*LocalCache
+
+	closeOnce sync.Once
+	closed    chan struct{} // 关闭时停止后台清理，没有后台清理时为 nil
+}
+
+func newShardedCache(builder *Builder, loader Loader) *shardedCache {
+	n := builder.concurrencyLevel
+	segmentBuilder := *builder
+	segmentBuilder.concurrencyLevel = 0
+	segmentBuilder.cleanupInterval = 0 // 所有 segment 共用一个后台清理的 goroutine
+	segmentBuilder.maximumSize = ceilDiv(builder.maximumSize, int64(n))
+	segmentBuilder.maximumWeight = ceilDiv(builder.maximumWeight, int64(n))
+	if segmentBuilder.statsCounter == nil && builder.recordStats {
+		// 所有 segment 共用一个 StatsCounter
+		segmentBuilder.statsCounter = NewSimpleStatsCounter()
+	}
+
+	sharded := &shardedCache{segments: make([]*LocalCache, n)}
+	for i := range sharded.segments {
+		sharded.segments[i] = segmentBuilder.build(loader)
+	}
+	if builder.cleanupInterval > 0 {
+		sharded.startCleanup(builder.cleanupInterval)
+	}
+	return sharded
+}
+
+func (sharded *shardedCache) segmentFor(key interface{}) *LocalCache {
+	return sharded.segments[hashKey(key)%uint64(len(sharded.segments))]
+}
+
+func (sharded *shardedCache) Get(key interface{}) (interface{}, error) {
+	return sharded.segmentFor(key).Get(key)
+}
+
+func (sharded *shardedCache) GetWithLoader(key interface{}, loader Loader) (interface{}, error) {
+	return sharded.segmentFor(key).GetWithLoader(key, loader)
+}
+
+func (sharded *shardedCache) GetIfPresent(key interface{}) interface{} {
+	return sharded.segmentFor(key).GetIfPresent(key)
+}
+
+// GetAll 按 segment 分组获取，loader 实现了 BulkLoader 时每个 segment 调用一次 LoadAll
+func (sharded *shardedCache) GetAll(keys []interface{}) (map[interface{}]interface{}, error) {
+	groups := make(map[*LocalCache][]interface{})
+	for _, key := range keys {
+		segment := sharded.segmentFor(key)
+		groups[segment] = append(groups[segment], key)
+	}
+
+	result := make(map[interface{}]interface{}, len(keys))
+	for segment, group := range groups {
+		values, err := segment.GetAll(group)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			result[key] = value
+		}
+	}
+	return result, nil
+}
+
+func (sharded *shardedCache) Refresh(key interface{}) concurrent.Future {
+	return sharded.segmentFor(key).Refresh(key)
+}
+
+func (sharded *shardedCache) Put(key, value interface{}) {
+	sharded.segmentFor(key).Put(key, value)
+}
+
+func (sharded *shardedCache) PutWithTTL(key, value interface{}, ttl time.Duration) {
+	sharded.segmentFor(key).PutWithTTL(key, value, ttl)
+}
+
+func (sharded *shardedCache) PutIfAbsent(key, value interface{}) (interface{}, bool) {
+	return sharded.segmentFor(key).PutIfAbsent(key, value)
+}
+
+func (sharded *shardedCache) Replace(key, value interface{}) (interface{}, bool) {
+	return sharded.segmentFor(key).Replace(key, value)
+}
+
+func (sharded *shardedCache) CompareAndSwap(key, old, new interface{}) bool {
+	return sharded.segmentFor(key).CompareAndSwap(key, old, new)
+}
+
+func (sharded *shardedCache) CompareAndDelete(key, old interface{}) bool {
+	return sharded.segmentFor(key).CompareAndDelete(key, old)
+}
+
+func (sharded *shardedCache) Delete(key interface{}) {
+	sharded.segmentFor(key).Delete(key)
+}
+
+func (sharded *shardedCache) Compute(key interface{}, remapping func(key, oldValue interface{}) interface{}) interface{} {
+	return sharded.segmentFor(key).Compute(key, remapping)
+}
+
+func (sharded *shardedCache) ComputeIfAbsent(key interface{}, mapping func(key interface{}) interface{}) interface{} {
+	return sharded.segmentFor(key).ComputeIfAbsent(key, mapping)
+}
+
+func (sharded *shardedCache) ComputeIfPresent(key interface{}, remapping func(key, oldValue interface{}) interface{}) interface{} {
+	return sharded.segmentFor(key).ComputeIfPresent(key, remapping)
+}
+
+func (sharded *shardedCache) Merge(key, value interface{}, remapping func(oldValue, value interface{}) interface{}) interface{} {
+	return sharded.segmentFor(key).Merge(key, value, remapping)
+}
+
+func (sharded *shardedCache) InvalidateKeys(keys []interface{}) {
+	for _, key := range keys {
+		sharded.segmentFor(key).Delete(key)
+	}
+}
+
+func (sharded *shardedCache) InvalidateAll() {
+	for _, segment := range sharded.segments {
+		segment.InvalidateAll()
+	}
+}
+
+func (sharded *shardedCache) Range(f func(key, value interface{}) bool) {
+	for _, segment := range sharded.segments {
+		stopped := false
+		segment.Range(func(key, value interface{}) bool {
+			if !f(key, value) {
+				stopped = true
+				return false
+			}
+			return true
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+func (sharded *shardedCache) Keys() []interface{} {
+	var keys []interface{}
+	for _, segment := range sharded.segments {
+		keys = append(keys, segment.Keys()...)
+	}
+	return keys
+}
+
+func (sharded *shardedCache) Size() int {
+	size := 0
+	for _, segment := range sharded.segments {
+		size += segment.Size()
+	}
+	return size
+}
+
+func (sharded *shardedCache) EstimatedSize() int {
+	size := 0
+	for _, segment := range sharded.segments {
+		size += segment.EstimatedSize()
+	}
+	return size
+}
+
+// Stats 所有 segment 共用一个 StatsCounter
+func (sharded *shardedCache) Stats() CacheStats {
+	return sharded.segments[0].Stats()
+}
+
+func (sharded *shardedCache) Cleanup() {
+	for _, segment := range sharded.segments {
+		segment.Cleanup()
+	}
+}
+
+func (sharded *shardedCache) Close() {
+	sharded.closeOnce.Do(func() {
+		if sharded.closed != nil {
+			close(sharded.closed)
+		}
+	})
+	for _, segment := range sharded.segments {
+		segment.Close()
+	}
+}
+
+func (sharded *shardedCache) startCleanup(interval time.Duration) {
+	sharded.closed = make(chan struct{})
+	go func() {
+		ticker := sharded.segments[0].getClock().NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				sharded.Cleanup()
+			case <-sharded.closed:
+				return
+			}
+		}
+	}()
+}
+
+// ceilDiv 向上取整的除法，用于将容量分配到各个 segment；capacity <= 0 (不限制) 时原样返回
+func ceilDiv(capacity, n int64) int64 {
+	if capacity <= 0 {
+		return capacity
+	}
+	return (capacity + n - 1) / n
+}
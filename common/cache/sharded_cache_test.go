@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestShardedCache(t *testing.T) {
+	cache := NewBuilder().
+		ConcurrencyLevel(8).
+		RecordStats().
+		Build(nil).(*shardedCache)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				cache.Put(g*1000+i, i)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if cache.Size() != 8000 || cache.EstimatedSize() != 8000 || len(cache.Keys()) != 8000 {
+		t.FailNow()
+	}
+	for key := 0; key < 8000; key++ {
+		if cache.GetIfPresent(key) != key%1000 {
+			t.FailNow()
+		}
+	}
+	cache.GetIfPresent(-1)
+	if stats := cache.Stats(); stats.HitCount != 8000 || stats.MissCount != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	count := 0
+	cache.Range(func(key, value interface{}) bool {
+		count++
+		return count < 10
+	})
+	if count != 10 {
+		t.FailNow()
+	}
+
+	cache.InvalidateKeys([]interface{}{0, 1, 2})
+	if cache.Size() != 7997 {
+		t.FailNow()
+	}
+	cache.InvalidateAll()
+	if cache.Size() != 0 {
+		t.FailNow()
+	}
+}
+
+func TestShardedCache_MaximumSize(t *testing.T) {
+	cache := NewBuilder().
+		ConcurrencyLevel(4).
+		MaximumSize(100).
+		Build(nil)
+
+	for i := 0; i < 1000; i++ {
+		cache.Put(i, i)
+	}
+	// 容量平均分配到每个 segment
+	if size := cache.Size(); size > 100 || size < 50 {
+		t.Fatalf("unexpected size %d", size)
+	}
+}
+
+func TestShardedCache_GetAll(t *testing.T) {
+	loader := &bulkStringLoader{StringLoader: StringLoader{prefix: "A"}}
+	cache := NewBuilder().
+		ConcurrencyLevel(4).
+		Build(loader)
+
+	keys := []interface{}{"a", "b", "c", "d", "e", "f", "missing"}
+	values, err := cache.GetAll(keys)
+	if err != nil || len(values) != 6 || values["a"] != "A-a" {
+		t.FailNow()
+	}
+	// 每个 segment 最多调用一次 LoadAll
+	if loader.bulkLoads > 4 {
+		t.FailNow()
+	}
+}
+
+// 相等的 key 必须落在同一个 segment，包括 +0 和 -0 这类位模式不同但相等的值
+func TestShardedCache_EqualKeys(t *testing.T) {
+	type floatKey struct {
+		F float64
+	}
+	cache := NewBuilder().
+		ConcurrencyLevel(16).
+		Build(nil)
+
+	negativeZero := math.Copysign(0, -1)
+	cache.Put(floatKey{0}, "a")
+	if value := cache.GetIfPresent(floatKey{negativeZero}); value != "a" {
+		t.Fatalf("unexpected value %v", value)
+	}
+	cache.Put(negativeZero, "b")
+	if value := cache.GetIfPresent(0.0); value != "b" {
+		t.Fatalf("unexpected value %v", value)
+	}
+}
@@ -0,0 +1,271 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// loadingCall 是一次正在进行的加载，同一个 key 并发的未命中等待同一次加载的结果
+type loadingCall struct {
+	wg sync.WaitGroup
+
+	value interface{}
+	err   error
+
+	// 加载期间 key 被 Put 或者 Delete，加载结果只返回给调用方，不再写入缓存
+	invalidated bool
+}
+
+// getOrLoad 在未命中时加载 key 对应的值
+//
+// 同一个 key 同时只有一个 goroutine 执行 loader.Load，其它 goroutine 等待其结果；
+// 加载期间不持有 cache.mu，不同 key 的加载可以并行，也不会阻塞 Put 等操作。
+func (cache *LocalCache) getOrLoad(key interface{}, loader Loader) (interface{}, error) {
+	cache.loadingMu.Lock()
+	if call, ok := cache.loading[key]; ok {
+		cache.loadingMu.Unlock()
+		call.wg.Wait()
+		if call.err == nil {
+			cache.stats().RecordHits(1)
+		}
+		return call.value, call.err
+	}
+
+	// 双检查，获取 loadingMu 之前可能有其它 goroutine 刚刚完成了加载
+	// NOTE: 持有 loadingMu 时不能触发 RemovalListener，所以这里不用 getLiveValue
+	if entry, ok := cache.getEntry(key); ok {
+		now := cache.now()
+		if value, ok := entry.load(); ok && !cache.isExpired(entry, now) {
+			cache.loadingMu.Unlock()
+			cache.recordRead(entry, value, now)
+			cache.stats().RecordHits(1)
+			cache.refreshIfNeeded(entry, now, loader)
+			return value, nil
+		}
+	}
+	if err, ok := cache.getCachedError(key); ok {
+		cache.loadingMu.Unlock()
+		cache.stats().RecordHits(1)
+		return nil, err
+	}
+
+	call := &loadingCall{}
+	call.wg.Add(1)
+	if cache.loading == nil {
+		cache.loading = make(map[interface{}]*loadingCall)
+	}
+	cache.loading[key] = call
+	atomic.AddInt32(&cache.loadingCount, 1)
+	cache.loadingMu.Unlock()
+
+	finished := false
+	defer func() {
+		if !finished {
+			// loader panic 时同样需要唤醒等待的 goroutine
+			call.err = fmt.Errorf("cache: loader panic while loading %v", key)
+			cache.finishLoading(key, call)
+		}
+	}()
+
+	call.value, call.err = cache.load(key, loader)
+	finished = true
+
+	if call.err != nil {
+		cache.loadingMu.Lock()
+		if !call.invalidated {
+			cache.cacheError(key, call.err)
+		}
+		cache.loadingMu.Unlock()
+		cache.finishLoading(key, call)
+		return nil, call.err
+	}
+
+	now := cache.now()
+	cache.loadingMu.Lock()
+	stored := !call.invalidated
+	var entry *referenceEntry
+	var previous unsafe.Pointer
+	if stored {
+		value := call.value
+		entry, previous = cache.store(key, &value)
+	}
+	cache.loadingMu.Unlock()
+	cache.finishLoading(key, call)
+
+	if stored {
+		cache.afterWrite(entry, previous, call.value, now)
+	}
+	return call.value, nil
+}
+
+// getAllOrLoad 通过 bulkLoader 一次加载 missing 中的 key，加载到的值写入 result
+//
+// 与 getOrLoad 一样为每个 key 登记 loadingCall：已经在加载的 key 等待其结果，不再重复加载；
+// 加载期间被 Put 或者 Delete 的 key，加载结果只返回给调用方，不再写入缓存。
+// 返回结果中多出的 key 没有登记 loadingCall，只在不存在时写入缓存
+func (cache *LocalCache) getAllOrLoad(missing []interface{}, bulkLoader BulkLoader, result map[interface{}]interface{}) error {
+	requested := make(map[interface{}]bool, len(missing))
+	calls := make(map[interface{}]*loadingCall, len(missing))
+	waiting := make(map[interface{}]*loadingCall)
+	var keys []interface{}
+	var hits []*referenceEntry
+
+	now := cache.now()
+	cache.loadingMu.Lock()
+	for _, key := range missing {
+		requested[key] = true
+		if call, ok := cache.loading[key]; ok {
+			waiting[key] = call
+			continue
+		}
+		// 双检查，同 getOrLoad
+		if entry, ok := cache.getEntry(key); ok {
+			if value, ok := entry.load(); ok && !cache.isExpired(entry, now) {
+				result[key] = value
+				hits = append(hits, entry)
+				continue
+			}
+		}
+		if err, ok := cache.getCachedError(key); ok {
+			if !errors.Is(err, NotFoundError) {
+				cache.loadingMu.Unlock()
+				return err
+			}
+			continue
+		}
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		call := &loadingCall{}
+		call.wg.Add(1)
+		if cache.loading == nil {
+			cache.loading = make(map[interface{}]*loadingCall)
+		}
+		cache.loading[key] = call
+		atomic.AddInt32(&cache.loadingCount, 1)
+		calls[key] = call
+	}
+	cache.loadingMu.Unlock()
+
+	for _, entry := range hits {
+		cache.recordRead(entry, result[entry.key], now)
+	}
+	cache.stats().RecordHits(len(hits))
+
+	if len(keys) > 0 {
+		finished := false
+		defer func() {
+			if !finished {
+				// loader panic 时同样需要唤醒等待的 goroutine
+				for key, call := range calls {
+					call.err = fmt.Errorf("cache: loader panic while loading %v", key)
+					cache.finishLoading(key, call)
+				}
+			}
+		}()
+
+		loaded, err := cache.loadAll(keys, bulkLoader)
+		finished = true
+		if err != nil {
+			for key, call := range calls {
+				call.err = err
+				cache.finishLoading(key, call)
+			}
+			return err
+		}
+
+		type write struct {
+			entry    *referenceEntry
+			previous unsafe.Pointer
+			value    interface{}
+		}
+		var writes []write
+		now = cache.now()
+		cache.loadingMu.Lock()
+		for key, call := range calls {
+			value, ok := loaded[key]
+			if !ok {
+				call.err = NotFoundError
+				if !call.invalidated {
+					cache.cacheError(key, NotFoundError)
+				}
+				continue
+			}
+			call.value = value
+			if !call.invalidated {
+				entry, previous := cache.store(key, &value)
+				writes = append(writes, write{entry, previous, value})
+			}
+		}
+		cache.loadingMu.Unlock()
+		for key, call := range calls {
+			cache.finishLoading(key, call)
+			if call.err == nil {
+				result[key] = call.value
+			}
+		}
+		for _, w := range writes {
+			cache.afterWrite(w.entry, w.previous, w.value, now)
+		}
+
+		for key, value := range loaded {
+			if !requested[key] {
+				cache.PutIfAbsent(key, value)
+			}
+		}
+	}
+
+	for key, call := range waiting {
+		call.wg.Wait()
+		if errors.Is(call.err, NotFoundError) {
+			continue
+		}
+		if call.err != nil {
+			return call.err
+		}
+		cache.stats().RecordHits(1)
+		result[key] = call.value
+	}
+	return nil
+}
+
+func (cache *LocalCache) finishLoading(key interface{}, call *loadingCall) {
+	cache.loadingMu.Lock()
+	if cache.loading[key] == call {
+		delete(cache.loading, key)
+		atomic.AddInt32(&cache.loadingCount, -1)
+	}
+	cache.loadingMu.Unlock()
+	call.wg.Done()
+}
+
+// invalidateAllLoading 使所有正在进行的加载结果及缓存的加载错误失效，在 InvalidateAll 之前调用
+func (cache *LocalCache) invalidateAllLoading() {
+	if cache.negative != nil {
+		cache.negative.InvalidateAll()
+	}
+	if atomic.LoadInt32(&cache.loadingCount) == 0 {
+		return
+	}
+	cache.loadingMu.Lock()
+	for _, call := range cache.loading {
+		call.invalidated = true
+	}
+	cache.loadingMu.Unlock()
+}
+
+// invalidateLoading 使 key 正在进行的加载结果不再写入缓存并删除缓存的加载错误，在 Put、Delete 之前调用
+func (cache *LocalCache) invalidateLoading(key interface{}) {
+	cache.forgetError(key)
+	if atomic.LoadInt32(&cache.loadingCount) == 0 {
+		return
+	}
+	cache.loadingMu.Lock()
+	if call, ok := cache.loading[key]; ok {
+		call.invalidated = true
+	}
+	cache.loadingMu.Unlock()
+}
@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// CacheStats 缓存的统计数据快照
+type CacheStats struct {
+	HitCount         int64
+	MissCount        int64
+	LoadSuccessCount int64
+	LoadFailureCount int64
+	TotalLoadTime    time.Duration
+	// 因为容量或者过期被淘汰的次数，不包括主动删除
+	EvictionCount int64
+}
+
+func (stats CacheStats) RequestCount() int64 {
+	return stats.HitCount + stats.MissCount
+}
+
+// HitRate 命中率，没有请求时为 1
+func (stats CacheStats) HitRate() float64 {
+	requestCount := stats.RequestCount()
+	if requestCount == 0 {
+		return 1
+	}
+	return float64(stats.HitCount) / float64(requestCount)
+}
+
+// MissRate 未命中率，没有请求时为 0
+func (stats CacheStats) MissRate() float64 {
+	requestCount := stats.RequestCount()
+	if requestCount == 0 {
+		return 0
+	}
+	return float64(stats.MissCount) / float64(requestCount)
+}
+
+func (stats CacheStats) LoadCount() int64 {
+	return stats.LoadSuccessCount + stats.LoadFailureCount
+}
+
+// AverageLoadPenalty 平均每次加载的耗时
+func (stats CacheStats) AverageLoadPenalty() time.Duration {
+	loadCount := stats.LoadCount()
+	if loadCount == 0 {
+		return 0
+	}
+	return stats.TotalLoadTime / time.Duration(loadCount)
+}
+
+// StatsCounter 记录缓存的统计数据，可以自行实现以对接自己的监控系统
+//
+// 实现需要是并发安全的
+type StatsCounter interface {
+	RecordHits(count int)
+	RecordMisses(count int)
+	RecordLoadSuccess(loadTime time.Duration)
+	RecordLoadFailure(loadTime time.Duration)
+	RecordEviction()
+	Snapshot() CacheStats
+}
+
+// SimpleStatsCounter 基于原子计数的 StatsCounter 实现
+type SimpleStatsCounter struct {
+	hitCount         int64
+	missCount        int64
+	loadSuccessCount int64
+	loadFailureCount int64
+	totalLoadTime    int64
+	evictionCount    int64
+}
+
+func NewSimpleStatsCounter() *SimpleStatsCounter {
+	return &SimpleStatsCounter{}
+}
+
+func (counter *SimpleStatsCounter) RecordHits(count int) {
+	atomic.AddInt64(&counter.hitCount, int64(count))
+}
+
+func (counter *SimpleStatsCounter) RecordMisses(count int) {
+	atomic.AddInt64(&counter.missCount, int64(count))
+}
+
+func (counter *SimpleStatsCounter) RecordLoadSuccess(loadTime time.Duration) {
+	atomic.AddInt64(&counter.loadSuccessCount, 1)
+	atomic.AddInt64(&counter.totalLoadTime, int64(loadTime))
+}
+
+func (counter *SimpleStatsCounter) RecordLoadFailure(loadTime time.Duration) {
+	atomic.AddInt64(&counter.loadFailureCount, 1)
+	atomic.AddInt64(&counter.totalLoadTime, int64(loadTime))
+}
+
+func (counter *SimpleStatsCounter) RecordEviction() {
+	atomic.AddInt64(&counter.evictionCount, 1)
+}
+
+func (counter *SimpleStatsCounter) Snapshot() CacheStats {
+	return CacheStats{
+		HitCount:         atomic.LoadInt64(&counter.hitCount),
+		MissCount:        atomic.LoadInt64(&counter.missCount),
+		LoadSuccessCount: atomic.LoadInt64(&counter.loadSuccessCount),
+		LoadFailureCount: atomic.LoadInt64(&counter.loadFailureCount),
+		TotalLoadTime:    time.Duration(atomic.LoadInt64(&counter.totalLoadTime)),
+		EvictionCount:    atomic.LoadInt64(&counter.evictionCount),
+	}
+}
+
+// 未开启统计时使用，不做任何记录
+type disabledStatsCounter struct{}
+
+func (counter disabledStatsCounter) RecordHits(count int)                     {}
+func (counter disabledStatsCounter) RecordMisses(count int)                   {}
+func (counter disabledStatsCounter) RecordLoadSuccess(loadTime time.Duration) {}
+func (counter disabledStatsCounter) RecordLoadFailure(loadTime time.Duration) {}
+func (counter disabledStatsCounter) RecordEviction()                          {}
+func (counter disabledStatsCounter) Snapshot() CacheStats                     { return CacheStats{} }
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vvwyy/peanut/common/clock/clocktest"
+)
+
+type failingLoader struct{}
+
+func (loader failingLoader) Load(key interface{}) (interface{}, error) {
+	return nil, errors.New("load failed")
+}
+
+func TestLocalCache_Stats(t *testing.T) {
+	cache := NewBuilder().
+		MaximumSize(2).
+		RecordStats().
+		Build(&StringLoader{prefix: "A"}).(*LocalCache)
+
+	cache.Get("a")                            // miss, load success
+	cache.Get("a")                            // hit
+	cache.GetIfPresent("b")                   // miss
+	cache.GetWithLoader("c", failingLoader{}) // miss, load failure
+	cache.Put("d", "d")
+	cache.Put("e", "e") // evict
+
+	stats := cache.Stats()
+	if stats.HitCount != 1 || stats.MissCount != 3 {
+		t.Logf("unexpected stats: %+v", stats)
+		t.FailNow()
+	}
+	if stats.LoadSuccessCount != 1 || stats.LoadFailureCount != 1 || stats.TotalLoadTime <= 0 {
+		t.Logf("unexpected stats: %+v", stats)
+		t.FailNow()
+	}
+	if stats.EvictionCount != 1 {
+		t.Logf("unexpected stats: %+v", stats)
+		t.FailNow()
+	}
+	if stats.HitRate() != 0.25 || stats.RequestCount() != 4 {
+		t.FailNow()
+	}
+}
+
+func TestLocalCache_StatsDisabled(t *testing.T) {
+	cache := NewBuilder().Build(nil).(*LocalCache)
+	cache.GetIfPresent("a")
+	if cache.Stats() != (CacheStats{}) {
+		t.FailNow()
+	}
+}
+
+// 过期的值无论被清理还是被新的写入替换，都计为一次淘汰
+func TestLocalCache_StatsExpired(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache := NewBuilder().
+		ExpireAfterWrite(time.Minute).
+		Clock(fakeClock).
+		RecordStats().
+		Build(nil).(*LocalCache)
+
+	cache.Put("a", "a")
+	cache.Put("b", "b")
+	cache.Put("c", "c")
+	fakeClock.Advance(2 * time.Minute)
+
+	cache.Put("a", "A")
+	cache.Compute("b", func(key, oldValue interface{}) interface{} {
+		return "B"
+	})
+	cache.Cleanup()
+	if stats := cache.Stats(); stats.EvictionCount != 3 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"time"
+)
+
+// 分层时间轮：按过期时间索引 entry，使过期的检查和清理均摊为 O(1)
+//
+// 1. 每一层 bucket 覆盖的时间跨度依次增大（约 16.8ms、1.07s、1.14m、1.22h、1.63d、6.5d），entry 按距离过期的时长放入对应层的 bucket；
+// 2. 时间推进时依次处理各层到期的 bucket：已经过期的 entry 被取出，其余的按新的过期时间重新放入；
+// 3. 读取时不移动 entry (延迟调度)：expireAfterAccess 的过期时间只会推后，在 bucket 到期时才重新放入。
+//
+// entry.timerPrev、entry.timerNext 由时间轮维护，受时间轮的锁保护。
+type timerWheel struct {
+	mu Mutex // protects following fields
+
+	nanos   time.Duration       // 上一次推进到的时间
+	buckets [][]*referenceEntry // 每个 bucket 是以哨兵 entry 为表头的双向循环链表
+
+	deadline func(entry *referenceEntry) time.Duration // entry 当前的过期时间，为 0 时不会过期
+}
+
+var (
+	timerWheelBuckets = []int{64, 64, 64, 32, 4, 1}
+	timerWheelSpans   = []time.Duration{1 << 24, 1 << 30, 1 << 36, 1 << 42, 1 << 47, 1 << 49, 1 << 49}
+	timerWheelShifts  = []uint{24, 30, 36, 42, 47, 49}
+)
+
+func newTimerWheel(now time.Duration, deadline func(entry *referenceEntry) time.Duration) *timerWheel {
+	wheel := &timerWheel{
+		nanos:    now,
+		buckets:  make([][]*referenceEntry, len(timerWheelBuckets)),
+		deadline: deadline,
+	}
+	for i, count := range timerWheelBuckets {
+		wheel.buckets[i] = make([]*referenceEntry, count)
+		for j := range wheel.buckets[i] {
+			sentinel := &referenceEntry{}
+			sentinel.timerPrev, sentinel.timerNext = sentinel, sentinel
+			wheel.buckets[i][j] = sentinel
+		}
+	}
+	return wheel
+}
+
+// schedule 按 entry 当前的过期时间放入时间轮，没有过期时间时移出时间轮
+func (wheel *timerWheel) schedule(entry *referenceEntry) {
+	wheel.mu.Lock()
+	wheel.unlink(entry)
+	if deadline := wheel.deadline(entry); deadline > 0 {
+		wheel.link(wheel.findBucket(deadline), entry)
+	}
+	wheel.mu.Unlock()
+}
+
+func (wheel *timerWheel) deschedule(entry *referenceEntry) {
+	wheel.mu.Lock()
+	wheel.unlink(entry)
+	wheel.mu.Unlock()
+}
+
+// advance 将时间轮推进到 now，返回已经过期的 entry（已移出时间轮）
+func (wheel *timerWheel) advance(now time.Duration) []*referenceEntry {
+	wheel.mu.Lock()
+	defer wheel.mu.Unlock()
+	return wheel.advanceLocked(now)
+}
+
+// tryAdvance 同 advance，时间轮正在被其它 goroutine 使用时直接返回 false
+func (wheel *timerWheel) tryAdvance(now time.Duration) ([]*referenceEntry, bool) {
+	if !wheel.mu.TryLock() {
+		return nil, false
+	}
+	defer wheel.mu.Unlock()
+	return wheel.advanceLocked(now), true
+}
+
+func (wheel *timerWheel) advanceLocked(now time.Duration) (expired []*referenceEntry) {
+	previous := wheel.nanos
+	if now <= previous {
+		return nil
+	}
+	wheel.nanos = now
+
+	for level, shift := range timerWheelShifts {
+		previousTicks := int64(previous) >> shift
+		currentTicks := int64(now) >> shift
+		if currentTicks <= previousTicks {
+			break // 更高层的 bucket 也不会到期
+		}
+		expired = wheel.expire(level, previousTicks, currentTicks-previousTicks, now, expired)
+	}
+	return expired
+}
+
+// expire 处理 level 层从 previousTicks 开始 delta 个 tick 内到期的 bucket
+func (wheel *timerWheel) expire(level int, previousTicks, delta int64, now time.Duration, expired []*referenceEntry) []*referenceEntry {
+	buckets := wheel.buckets[level]
+	mask := int64(len(buckets) - 1)
+	steps := delta + 1 // 包括当前的 bucket
+	if steps > int64(len(buckets)) {
+		steps = int64(len(buckets))
+	}
+
+	start := previousTicks & mask
+	for i := start; i < start+steps; i++ {
+		// 先摘下整个链表，重新放入的 entry 可能回到同一个 bucket
+		sentinel := buckets[i&mask]
+		entry := sentinel.timerNext
+		sentinel.timerPrev, sentinel.timerNext = sentinel, sentinel
+
+		for entry != sentinel {
+			next := entry.timerNext
+			entry.timerPrev, entry.timerNext = nil, nil
+			if _, ok := entry.load(); ok { // 已被删除的 entry 直接丢弃
+				if deadline := wheel.deadline(entry); deadline > 0 && deadline <= now {
+					expired = append(expired, entry)
+				} else if deadline > 0 {
+					wheel.link(wheel.findBucket(deadline), entry)
+				}
+			}
+			entry = next
+		}
+	}
+	return expired
+}
+
+// findBucket 返回 deadline 对应的 bucket 的哨兵
+func (wheel *timerWheel) findBucket(deadline time.Duration) *referenceEntry {
+	if deadline < wheel.nanos {
+		deadline = wheel.nanos // 已经过期的 entry 放入当前的 bucket，在下一次推进时取出
+	}
+	duration := deadline - wheel.nanos
+	last := len(wheel.buckets) - 1
+	for level := 0; level < last; level++ {
+		if duration < timerWheelSpans[level+1] {
+			ticks := int64(deadline) >> timerWheelShifts[level]
+			buckets := wheel.buckets[level]
+			return buckets[ticks&int64(len(buckets)-1)]
+		}
+	}
+	return wheel.buckets[last][0]
+}
+
+func (wheel *timerWheel) link(sentinel, entry *referenceEntry) {
+	entry.timerPrev = sentinel.timerPrev
+	entry.timerNext = sentinel
+	sentinel.timerPrev.timerNext = entry
+	sentinel.timerPrev = entry
+}
+
+func (wheel *timerWheel) unlink(entry *referenceEntry) {
+	if entry.timerNext == nil {
+		return
+	}
+	entry.timerPrev.timerNext = entry.timerNext
+	entry.timerNext.timerPrev = entry.timerPrev
+	entry.timerPrev, entry.timerNext = nil, nil
+}
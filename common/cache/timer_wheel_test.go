@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimerWheel(t *testing.T) {
+	deadlines := make(map[*referenceEntry]time.Duration)
+	start := time.Duration(time.Now().UnixNano())
+	wheel := newTimerWheel(start, func(entry *referenceEntry) time.Duration {
+		return deadlines[entry]
+	})
+
+	durations := []time.Duration{
+		10 * time.Millisecond, time.Second, 2 * time.Minute, 3 * time.Hour, 2 * 24 * time.Hour, 30 * 24 * time.Hour,
+	}
+	entries := make([]*referenceEntry, len(durations))
+	for i, duration := range durations {
+		entries[i] = newEntry(i, i)
+		deadlines[entries[i]] = start + duration
+		wheel.schedule(entries[i])
+	}
+
+	// 每次推进只取出已经过期的 entry
+	now := start
+	for i, duration := range durations {
+		if expired := wheel.advance(start + duration - time.Millisecond); len(expired) != 0 {
+			t.Fatalf("expired too early: %v", expired[0].key)
+		}
+		now = start + duration + timerWheelSpans[0]
+		expired := wheel.advance(now)
+		if len(expired) != 1 || expired[0] != entries[i] {
+			t.Fatalf("expected entry %d expired at %v, got %d entries", i, duration, len(expired))
+		}
+	}
+	if len(wheel.advance(now+365*24*time.Hour)) != 0 {
+		t.FailNow()
+	}
+}
+
+func TestTimerWheel_Reschedule(t *testing.T) {
+	deadlines := make(map[*referenceEntry]time.Duration)
+	start := time.Duration(time.Now().UnixNano())
+	wheel := newTimerWheel(start, func(entry *referenceEntry) time.Duration {
+		return deadlines[entry]
+	})
+
+	entry := newEntry("a", "a")
+	deadlines[entry] = start + time.Second
+	wheel.schedule(entry)
+
+	// 过期时间推后之后不需要重新调度，bucket 到期时重新放入
+	deadlines[entry] = start + time.Minute
+	if len(wheel.advance(start+2*time.Second)) != 0 {
+		t.FailNow()
+	}
+	if expired := wheel.advance(start + time.Minute + time.Second); len(expired) != 1 || expired[0] != entry {
+		t.FailNow()
+	}
+
+	// 移出时间轮后不会再被取出
+	deadlines[entry] = start + 2*time.Minute
+	wheel.schedule(entry)
+	wheel.deschedule(entry)
+	if len(wheel.advance(start+time.Hour)) != 0 {
+		t.FailNow()
+	}
+
+	// 已被删除的 entry 直接丢弃
+	deadlines[entry] = start + 2*time.Hour
+	wheel.schedule(entry)
+	entry.delete()
+	if len(wheel.advance(start+3*time.Hour)) != 0 || entry.timerNext != nil {
+		t.FailNow()
+	}
+}
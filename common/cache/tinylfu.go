@@ -0,0 +1,305 @@
+package cache
+
+import (
+	"container/list"
+)
+
+// W-TinyLFU 淘汰策略
+//
+// 1. 新 entry 先进入 window 区 (LRU，约占容量的 1%)，用来容纳突发的新数据；
+// 2. 从 window 区淘汰出来的 entry 作为候选者，与 main 区 probation 段的淘汰者比较访问频率，频率高的留下；
+// 3. main 区是分段 LRU (SLRU)：probation 段中再次被访问的 entry 晋升到 protected 段 (约占 main 的 80%)；
+// 4. 访问频率由 count-min sketch 近似统计，并定期衰减，使历史热点逐渐冷却。
+//
+// 扫描类的访问只会经过 window 区，很难挤掉 main 区中频率更高的热点数据。
+type tinyLFUPolicy struct {
+	mu Mutex // protects following fields
+
+	capacity          int64
+	windowCapacity    int64
+	protectedCapacity int64
+
+	// 各区域 entry 的权重之和
+	windowWeight    int64
+	probationWeight int64
+	protectedWeight int64
+
+	window    *list.List
+	probation *list.List
+	protected *list.List
+	nodes     map[*referenceEntry]*list.Element
+
+	sketch *countMinSketch
+}
+
+const (
+	windowQueue = iota
+	probationQueue
+	protectedQueue
+)
+
+type tinyLFUNode struct {
+	entry *referenceEntry
+	hash  uint64
+	queue int
+}
+
+func newTinyLFUPolicy(capacity int64) *tinyLFUPolicy {
+	windowCapacity := capacity / 100
+	if windowCapacity < 1 {
+		windowCapacity = 1
+	}
+	mainCapacity := capacity - windowCapacity
+	return &tinyLFUPolicy{
+		capacity:          capacity,
+		windowCapacity:    windowCapacity,
+		protectedCapacity: mainCapacity * 8 / 10,
+		window:            list.New(),
+		probation:         list.New(),
+		protected:         list.New(),
+		nodes:             make(map[*referenceEntry]*list.Element),
+		sketch:            newCountMinSketch(capacity),
+	}
+}
+
+func (policy *tinyLFUPolicy) recordAccess(entry *referenceEntry) {
+	if !policy.mu.TryLock() { // NOTE: 读操作只尝试记录，不做强制
+		return
+	}
+	if element, ok := policy.nodes[entry]; ok {
+		policy.sketch.increment(element.Value.(*tinyLFUNode).hash)
+		policy.onHit(element)
+	}
+	policy.mu.Unlock()
+}
+
+func (policy *tinyLFUPolicy) recordWrite(entry *referenceEntry, weight int64) (victims []*referenceEntry) {
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+
+	if _, ok := entry.load(); !ok { // 写入后被并发删除，见 evictionPolicy.recordWrite
+		return nil
+	}
+	if weight > policy.capacity {
+		// 超过最大权重的 entry 只淘汰其自身，不挤掉其它 entry
+		if element, ok := policy.nodes[entry]; ok {
+			node := element.Value.(*tinyLFUNode)
+			policy.queueOf(node).Remove(element)
+			*policy.weightOf(node) -= entry.weight
+			delete(policy.nodes, entry)
+		}
+		return []*referenceEntry{entry}
+	}
+
+	if element, ok := policy.nodes[entry]; ok {
+		node := element.Value.(*tinyLFUNode)
+		*policy.weightOf(node) += weight - entry.weight
+		entry.weight = weight
+		policy.sketch.increment(node.hash)
+		policy.onHit(element)
+	} else {
+		node := &tinyLFUNode{entry: entry, hash: hashKey(entry.key), queue: windowQueue}
+		entry.weight = weight
+		policy.sketch.increment(node.hash)
+		policy.nodes[entry] = policy.window.PushFront(node)
+		policy.windowWeight += weight
+		policy.sketch.ensureCapacity(int64(len(policy.nodes)))
+	}
+
+	return policy.evict()
+}
+
+func (policy *tinyLFUPolicy) remove(entry *referenceEntry) {
+	policy.mu.Lock()
+	if element, ok := policy.nodes[entry]; ok {
+		node := element.Value.(*tinyLFUNode)
+		policy.queueOf(node).Remove(element)
+		*policy.weightOf(node) -= entry.weight
+		delete(policy.nodes, entry)
+	}
+	policy.mu.Unlock()
+}
+
+func (policy *tinyLFUPolicy) onHit(element *list.Element) {
+	node := element.Value.(*tinyLFUNode)
+	switch node.queue {
+	case windowQueue:
+		policy.window.MoveToFront(element)
+	case protectedQueue:
+		policy.protected.MoveToFront(element)
+	case probationQueue:
+		// 晋升到 protected 段
+		policy.move(element, protectedQueue)
+	}
+
+	// protected 段超出时将其最久未使用的 entry 降级到 probation 段
+	for policy.protectedWeight > policy.protectedCapacity && policy.protected.Len() > 1 {
+		policy.move(policy.protected.Back(), probationQueue)
+	}
+}
+
+func (policy *tinyLFUPolicy) evict() (victims []*referenceEntry) {
+	// window 区超出时，将最久未使用的 entry 移入 probation 段作为候选者
+	for policy.windowWeight > policy.windowCapacity && policy.window.Len() > 0 {
+		policy.move(policy.window.Back(), probationQueue)
+	}
+
+	for policy.weightedSize() > policy.capacity {
+		candidate := policy.probation.Front()
+		victim := policy.probation.Back()
+		if candidate == nil {
+			// probation 段为空，依次淘汰 window 区、protected 段的 entry
+			victim = policy.window.Back()
+			if victim == nil {
+				victim = policy.protected.Back()
+			}
+		} else if candidate != victim {
+			// 准入判断：候选者的访问频率更高时才淘汰原有的 entry，否则淘汰候选者
+			candidateFrequency := policy.sketch.frequency(candidate.Value.(*tinyLFUNode).hash)
+			victimFrequency := policy.sketch.frequency(victim.Value.(*tinyLFUNode).hash)
+			if candidateFrequency <= victimFrequency {
+				victim = candidate
+			}
+		}
+
+		node := victim.Value.(*tinyLFUNode)
+		policy.queueOf(node).Remove(victim)
+		*policy.weightOf(node) -= node.entry.weight
+		delete(policy.nodes, node.entry)
+		victims = append(victims, node.entry)
+	}
+	return victims
+}
+
+// move 将 entry 移动到另一个区域的表头
+func (policy *tinyLFUPolicy) move(element *list.Element, queue int) {
+	node := element.Value.(*tinyLFUNode)
+	policy.queueOf(node).Remove(element)
+	*policy.weightOf(node) -= node.entry.weight
+
+	node.queue = queue
+	policy.nodes[node.entry] = policy.queueOf(node).PushFront(node)
+	*policy.weightOf(node) += node.entry.weight
+}
+
+func (policy *tinyLFUPolicy) weightedSize() int64 {
+	return policy.windowWeight + policy.probationWeight + policy.protectedWeight
+}
+
+func (policy *tinyLFUPolicy) weightOf(node *tinyLFUNode) *int64 {
+	switch node.queue {
+	case windowQueue:
+		return &policy.windowWeight
+	case probationQueue:
+		return &policy.probationWeight
+	default:
+		return &policy.protectedWeight
+	}
+}
+
+func (policy *tinyLFUPolicy) queueOf(node *tinyLFUNode) *list.List {
+	switch node.queue {
+	case windowQueue:
+		return policy.window
+	case probationQueue:
+		return policy.probation
+	default:
+		return policy.protected
+	}
+}
+
+// ========================================================================================================
+// =========== count-min sketch
+// ========================================================================================================
+
+const (
+	sketchDepth      = 4
+	sketchMaxCounter = 15
+)
+
+var sketchSeeds = [sketchDepth]uint64{
+	0xc3a5c85c97cb3127, 0xb492b66fbe98f273, 0x9ae16a3b2f90404f, 0xcbf29ce484222325,
+}
+
+// 近似统计访问频率，counter 最大为 15；
+// 增加次数达到 sampleSize 时所有 counter 减半，使频率随时间衰减
+type countMinSketch struct {
+	table      [sketchDepth][]uint8
+	mask       uint64
+	additions  int64
+	sampleSize int64
+}
+
+// 初始宽度不超过 sketchInitialMaxWidth，之后随 entry 数量增长
+// （按权重限制容量时 capacity 不代表 entry 数量）
+const sketchInitialMaxWidth = 1 << 16
+
+func newCountMinSketch(capacity int64) *countMinSketch {
+	if capacity > sketchInitialMaxWidth {
+		capacity = sketchInitialMaxWidth
+	}
+	sketch := &countMinSketch{}
+	sketch.resize(capacity)
+	return sketch
+}
+
+// ensureCapacity 在 entry 数量超过 sketch 宽度时扩容，扩容后重新开始统计
+func (sketch *countMinSketch) ensureCapacity(size int64) {
+	if size > int64(sketch.mask)+1 && size <= int64(maximumCapacity) {
+		sketch.resize(size)
+	}
+}
+
+func (sketch *countMinSketch) resize(capacity int64) {
+	width := int64(16)
+	for width < capacity && width < int64(maximumCapacity) {
+		width <<= 1
+	}
+	sketch.mask = uint64(width - 1)
+	sketch.sampleSize = 10 * width
+	sketch.additions = 0
+	for i := range sketch.table {
+		sketch.table[i] = make([]uint8, width)
+	}
+}
+
+func (sketch *countMinSketch) index(hash uint64, i int) uint64 {
+	h := (hash ^ sketchSeeds[i]) * sketchSeeds[(i+1)%sketchDepth]
+	return (h >> 32) & sketch.mask
+}
+
+func (sketch *countMinSketch) increment(hash uint64) {
+	added := false
+	for i := range sketch.table {
+		index := sketch.index(hash, i)
+		if sketch.table[i][index] < sketchMaxCounter {
+			sketch.table[i][index]++
+			added = true
+		}
+	}
+	if added {
+		sketch.additions++
+		if sketch.additions >= sketch.sampleSize {
+			sketch.reset()
+		}
+	}
+}
+
+func (sketch *countMinSketch) frequency(hash uint64) uint8 {
+	frequency := uint8(sketchMaxCounter)
+	for i := range sketch.table {
+		if count := sketch.table[i][sketch.index(hash, i)]; count < frequency {
+			frequency = count
+		}
+	}
+	return frequency
+}
+
+func (sketch *countMinSketch) reset() {
+	for i := range sketch.table {
+		for j := range sketch.table[i] {
+			sketch.table[i][j] >>= 1
+		}
+	}
+	sketch.additions /= 2
+}
@@ -0,0 +1,246 @@
+// Package typed 提供类型安全的泛型缓存，是对 cache.LoadingCache 的包装
+//
+//	users := typed.NewLoadingCache[int64, *User](cache.NewBuilder().ExpireAfterWrite(time.Minute), userLoader)
+//	user, err := users.Get(42)
+package typed
+
+import (
+	"time"
+
+	"github.com/vvwyy/peanut/common/cache"
+	"github.com/vvwyy/peanut/concurrent"
+)
+
+// builtCache cache.Builder.Build 返回的缓存实现的所有接口
+type builtCache interface {
+	cache.LoadingCache
+	cache.LoaderCache
+	cache.ConditionalCache
+	cache.ComputingCache
+	cache.InvalidatingCache
+	cache.ExpiringCache
+	cache.StatsCache
+	cache.Closer
+}
+
+// Cache 类型安全的缓存，没有 loader
+type Cache[K comparable, V any] struct {
+	cache builtCache
+}
+
+// NewCache 按 builder 的配置创建 Cache
+func NewCache[K comparable, V any](builder *cache.Builder) *Cache[K, V] {
+	return &Cache[K, V]{cache: builder.Build(nil).(builtCache)}
+}
+
+// GetIfPresent 返回 key 对应的值，不存在或者已过期时返回 false
+func (c *Cache[K, V]) GetIfPresent(key K) (V, bool) {
+	return valueOf[V](c.cache.GetIfPresent(key))
+}
+
+func (c *Cache[K, V]) Put(key K, value V) {
+	c.cache.Put(key, value)
+}
+
+// PutWithTTL 写入 key 的值并设置 ttl 后过期
+func (c *Cache[K, V]) PutWithTTL(key K, value V, ttl time.Duration) {
+	c.cache.PutWithTTL(key, value, ttl)
+}
+
+func (c *Cache[K, V]) Delete(key K) {
+	c.cache.Delete(key)
+}
+
+// InvalidateKeys 删除 keys 对应的 entry
+func (c *Cache[K, V]) InvalidateKeys(keys []K) {
+	c.cache.InvalidateKeys(untypedKeys(keys))
+}
+
+func (c *Cache[K, V]) InvalidateAll() {
+	c.cache.InvalidateAll()
+}
+
+func (c *Cache[K, V]) Range(f func(key K, value V) bool) {
+	c.cache.Range(func(key, value interface{}) bool {
+		v, _ := valueOf[V](value)
+		return f(key.(K), v)
+	})
+}
+
+// PutIfAbsent key 不存在时写入 value，已存在时返回已存在的值及 true
+func (c *Cache[K, V]) PutIfAbsent(key K, value V) (V, bool) {
+	existing, loaded := c.cache.PutIfAbsent(key, value)
+	if !loaded {
+		var zero V
+		return zero, false
+	}
+	v, _ := valueOf[V](existing)
+	return v, true
+}
+
+// Replace key 存在时将其值替换为 value，返回被替换的值及 true
+func (c *Cache[K, V]) Replace(key K, value V) (V, bool) {
+	previous, replaced := c.cache.Replace(key, value)
+	if !replaced {
+		var zero V
+		return zero, false
+	}
+	v, _ := valueOf[V](previous)
+	return v, true
+}
+
+// CompareAndSwap key 的值等于 old 时替换为 new，V 必须是可比较的
+func (c *Cache[K, V]) CompareAndSwap(key K, old, new V) bool {
+	return c.cache.CompareAndSwap(key, old, new)
+}
+
+// CompareAndDelete key 的值等于 old 时删除，V 必须是可比较的
+func (c *Cache[K, V]) CompareAndDelete(key K, old V) bool {
+	return c.cache.CompareAndDelete(key, old)
+}
+
+// Compute 原子地将 key 的值替换为 remapping 的结果，remapping 返回 false 时删除 key；
+// 返回 key 当前的值，见 cache.ComputingCache.Compute
+func (c *Cache[K, V]) Compute(key K, remapping func(key K, oldValue V, present bool) (V, bool)) (V, bool) {
+	return valueOf[V](c.cache.Compute(key, func(_, oldValue interface{}) interface{} {
+		old, present := valueOf[V](oldValue)
+		return keepOrNil(remapping(key, old, present))
+	}))
+}
+
+// ComputeIfAbsent key 不存在时原子地将其值设置为 mapping 的结果，mapping 返回 false 时不写入
+func (c *Cache[K, V]) ComputeIfAbsent(key K, mapping func(key K) (V, bool)) (V, bool) {
+	return valueOf[V](c.cache.ComputeIfAbsent(key, func(interface{}) interface{} {
+		return keepOrNil(mapping(key))
+	}))
+}
+
+// ComputeIfPresent key 存在时原子地将其值替换为 remapping 的结果，remapping 返回 false 时删除 key
+func (c *Cache[K, V]) ComputeIfPresent(key K, remapping func(key K, oldValue V) (V, bool)) (V, bool) {
+	return valueOf[V](c.cache.ComputeIfPresent(key, func(_, oldValue interface{}) interface{} {
+		old, _ := valueOf[V](oldValue)
+		return keepOrNil(remapping(key, old))
+	}))
+}
+
+// Merge key 不存在时写入 value，否则原子地将其值替换为 remapping 的结果，remapping 返回 false 时删除 key
+func (c *Cache[K, V]) Merge(key K, value V, remapping func(oldValue, value V) (V, bool)) (V, bool) {
+	return valueOf[V](c.cache.Merge(key, value, func(oldValue, value interface{}) interface{} {
+		old, _ := valueOf[V](oldValue)
+		v, _ := valueOf[V](value)
+		return keepOrNil(remapping(old, v))
+	}))
+}
+
+// Keys 返回所有未过期的 key
+func (c *Cache[K, V]) Keys() []K {
+	untyped := c.cache.Keys()
+	keys := make([]K, len(untyped))
+	for i, key := range untyped {
+		keys[i] = key.(K)
+	}
+	return keys
+}
+
+// Size 返回未过期的 entry 数量
+func (c *Cache[K, V]) Size() int {
+	return c.cache.Size()
+}
+
+// EstimatedSize 返回 entry 数量的估计值
+func (c *Cache[K, V]) EstimatedSize() int {
+	return c.cache.EstimatedSize()
+}
+
+func (c *Cache[K, V]) Stats() cache.CacheStats {
+	return c.cache.Stats()
+}
+
+func (c *Cache[K, V]) Cleanup() {
+	c.cache.Cleanup()
+}
+
+func (c *Cache[K, V]) Close() {
+	c.cache.Close()
+}
+
+// Unwrap 返回被包装的 cache.LoadingCache
+func (c *Cache[K, V]) Unwrap() cache.LoadingCache {
+	return c.cache
+}
+
+// LoadingCache 类型安全的缓存，未命中时通过 Loader 加载
+type LoadingCache[K comparable, V any] struct {
+	Cache[K, V]
+}
+
+// NewLoadingCache 按 builder 的配置创建 LoadingCache；
+// loader 实现了 BulkLoader 或者 Reloader 时，GetAll 及刷新时同样会使用
+func NewLoadingCache[K comparable, V any](builder *cache.Builder, loader Loader[K, V]) *LoadingCache[K, V] {
+	return &LoadingCache[K, V]{Cache: Cache[K, V]{cache: builder.Build(adaptLoader(loader)).(builtCache)}}
+}
+
+// Get 返回 key 对应的值，未命中时通过 loader 加载
+func (c *LoadingCache[K, V]) Get(key K) (V, error) {
+	value, err := c.cache.Get(key)
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	v, _ := valueOf[V](value)
+	return v, nil
+}
+
+// GetWithLoader 同 Get，使用指定的 loader 加载
+func (c *LoadingCache[K, V]) GetWithLoader(key K, loader Loader[K, V]) (V, error) {
+	value, err := c.cache.GetWithLoader(key, adaptLoader(loader))
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	v, _ := valueOf[V](value)
+	return v, nil
+}
+
+// GetAll 返回多个 key 对应的值，见 cache.LoadingCache.GetAll
+func (c *LoadingCache[K, V]) GetAll(keys []K) (map[K]V, error) {
+	values, err := c.cache.GetAll(untypedKeys(keys))
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[K]V, len(values))
+	for key, value := range values {
+		result[key.(K)], _ = valueOf[V](value)
+	}
+	return result, nil
+}
+
+// Refresh 异步重新加载 key 对应的值，返回的 Future 的结果为 V
+func (c *LoadingCache[K, V]) Refresh(key K) concurrent.Future {
+	return c.cache.Refresh(key)
+}
+
+func untypedKeys[K comparable](keys []K) []interface{} {
+	untyped := make([]interface{}, len(keys))
+	for i, key := range keys {
+		untyped[i] = key
+	}
+	return untyped
+}
+
+// keepOrNil 将 remapping 的结果转换为缓存的值，nil 表示删除
+func keepOrNil[V any](value V, keep bool) interface{} {
+	if !keep {
+		return nil
+	}
+	return value
+}
+
+// valueOf 将缓存中的值转换为 V，nil 表示不存在
+func valueOf[V any](value interface{}) (V, bool) {
+	if value == nil {
+		var zero V
+		return zero, false
+	}
+	return value.(V), true
+}
@@ -0,0 +1,180 @@
+package typed
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/vvwyy/peanut/common/cache"
+)
+
+type user struct {
+	id   int64
+	name string
+}
+
+type userLoader struct {
+	bulkLoads int
+}
+
+func (loader *userLoader) Load(id int64) (*user, error) {
+	if id < 0 {
+		return nil, errors.New("invalid id")
+	}
+	return &user{id: id, name: "user" + strconv.FormatInt(id, 10)}, nil
+}
+
+func (loader *userLoader) LoadAll(ids []int64) (map[int64]*user, error) {
+	loader.bulkLoads++
+	users := make(map[int64]*user, len(ids))
+	for _, id := range ids {
+		users[id], _ = loader.Load(id)
+	}
+	return users, nil
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache[string, int](cache.NewBuilder().ExpireAfterWrite(time.Minute))
+
+	if _, ok := c.GetIfPresent("a"); ok {
+		t.FailNow()
+	}
+	c.Put("a", 1)
+	c.Put("b", 2)
+	if value, ok := c.GetIfPresent("a"); !ok || value != 1 {
+		t.FailNow()
+	}
+
+	sum := 0
+	c.Range(func(key string, value int) bool {
+		sum += value
+		return true
+	})
+	if sum != 3 {
+		t.FailNow()
+	}
+
+	c.Delete("a")
+	if _, ok := c.GetIfPresent("a"); ok {
+		t.FailNow()
+	}
+}
+
+func TestLoadingCache(t *testing.T) {
+	loader := &userLoader{}
+	users := NewLoadingCache[int64, *user](cache.NewBuilder().MaximumSize(100), loader)
+
+	u, err := users.Get(1)
+	if err != nil || u.name != "user1" {
+		t.FailNow()
+	}
+	if cached, _ := users.Get(1); cached != u {
+		t.FailNow()
+	}
+	if _, err := users.Get(-1); err == nil {
+		t.FailNow()
+	}
+
+	all, err := users.GetAll([]int64{1, 2, 3})
+	if err != nil || len(all) != 3 || all[1] != u || all[3].name != "user3" {
+		t.FailNow()
+	}
+	if loader.bulkLoads != 1 {
+		t.FailNow()
+	}
+
+	value, err := users.Refresh(2).Get()
+	if err != nil || value.(*user).name != "user2" {
+		t.FailNow()
+	}
+}
+
+// 重新加载时返回最近一次的错误，旧值为 nil 时返回 nil
+type errorReloader struct {
+	last error
+}
+
+func (loader *errorReloader) Load(key string) (error, error) {
+	return errors.New(key), nil
+}
+
+func (loader *errorReloader) Reload(key string, oldValue error) (error, error) {
+	loader.last = oldValue
+	return errors.New(key), nil
+}
+
+func TestLoadingCache_ReloadInterface(t *testing.T) {
+	loader := &errorReloader{}
+	c := NewLoadingCache[string, error](cache.NewBuilder(), loader)
+
+	// V 为接口类型时缓存的值可以为 nil
+	c.Put("a", nil)
+	value, err := c.Refresh("a").Get()
+	if err != nil || value.(error).Error() != "a" || loader.last != nil {
+		t.Fatalf("unexpected value %v, err %v", value, err)
+	}
+}
+
+func TestCache_Compute(t *testing.T) {
+	c := NewCache[string, int](cache.NewBuilder())
+
+	add := func(oldValue, value int) (int, bool) {
+		return oldValue + value, true
+	}
+	c.Merge("a", 1, add)
+	if value, ok := c.Merge("a", 2, add); !ok || value != 3 {
+		t.FailNow()
+	}
+
+	value, ok := c.Compute("a", func(key string, oldValue int, present bool) (int, bool) {
+		return oldValue * 10, present
+	})
+	if !ok || value != 30 {
+		t.FailNow()
+	}
+
+	if value, ok := c.ComputeIfAbsent("a", func(key string) (int, bool) { return 0, true }); !ok || value != 30 {
+		t.FailNow()
+	}
+	if _, ok := c.ComputeIfPresent("a", func(key string, oldValue int) (int, bool) { return 0, false }); ok {
+		t.FailNow()
+	}
+	if _, ok := c.GetIfPresent("a"); ok {
+		t.FailNow()
+	}
+}
+
+func TestCache_MergeInterface(t *testing.T) {
+	c := NewCache[string, error](cache.NewBuilder())
+	someError := errors.New("some error")
+	c.Put("a", someError)
+
+	// V 为接口类型时合并的值可以为 nil
+	value, ok := c.Merge("a", nil, func(oldValue, value error) (error, bool) {
+		if value == nil {
+			return oldValue, true
+		}
+		return value, true
+	})
+	if !ok || value != someError {
+		t.FailNow()
+	}
+}
+
+func TestCache_PutIfAbsent(t *testing.T) {
+	c := NewCache[string, int](cache.NewBuilder())
+
+	if _, loaded := c.PutIfAbsent("a", 1); loaded {
+		t.FailNow()
+	}
+	if existing, loaded := c.PutIfAbsent("a", 2); !loaded || existing != 1 {
+		t.FailNow()
+	}
+	if previous, replaced := c.Replace("a", 3); !replaced || previous != 1 {
+		t.FailNow()
+	}
+	if !c.CompareAndSwap("a", 3, 4) || c.CompareAndDelete("a", 3) || !c.CompareAndDelete("a", 4) {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,79 @@
+package typed
+
+import (
+	"github.com/vvwyy/peanut/common/cache"
+)
+
+// Loader 类型安全的 cache.Loader
+type Loader[K comparable, V any] interface {
+	Load(key K) (V, error)
+}
+
+// BulkLoader 类型安全的 cache.BulkLoader，LoadingCache.GetAll 对所有未命中的 key 只调用一次 LoadAll
+type BulkLoader[K comparable, V any] interface {
+	Loader[K, V]
+	LoadAll(keys []K) (map[K]V, error)
+}
+
+// Reloader 类型安全的 cache.Reloader，可以由 Loader 实现
+type Reloader[K comparable, V any] interface {
+	Reload(key K, oldValue V) (V, error)
+}
+
+// 将 Loader 适配为 cache.Loader 及 cache.Reloader
+type loaderAdapter[K comparable, V any] struct {
+	loader Loader[K, V]
+}
+
+func (adapter loaderAdapter[K, V]) Load(key interface{}) (interface{}, error) {
+	value, err := adapter.loader.Load(key.(K))
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (adapter loaderAdapter[K, V]) Reload(key, oldValue interface{}) (interface{}, error) {
+	reloader, ok := adapter.loader.(Reloader[K, V])
+	if !ok {
+		return adapter.Load(key)
+	}
+	old, _ := valueOf[V](oldValue)
+	value, err := reloader.Reload(key.(K), old)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// 将 BulkLoader 适配为 cache.BulkLoader
+type bulkLoaderAdapter[K comparable, V any] struct {
+	loaderAdapter[K, V]
+	bulkLoader BulkLoader[K, V]
+}
+
+func (adapter bulkLoaderAdapter[K, V]) LoadAll(keys []interface{}) (map[interface{}]interface{}, error) {
+	typedKeys := make([]K, len(keys))
+	for i, key := range keys {
+		typedKeys[i] = key.(K)
+	}
+	values, err := adapter.bulkLoader.LoadAll(typedKeys)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[interface{}]interface{}, len(values))
+	for key, value := range values {
+		result[key] = value
+	}
+	return result, nil
+}
+
+func adaptLoader[K comparable, V any](loader Loader[K, V]) cache.Loader {
+	if loader == nil {
+		return nil
+	}
+	if bulkLoader, ok := loader.(BulkLoader[K, V]); ok {
+		return bulkLoaderAdapter[K, V]{loaderAdapter: loaderAdapter[K, V]{loader: loader}, bulkLoader: bulkLoader}
+	}
+	return loaderAdapter[K, V]{loader: loader}
+}
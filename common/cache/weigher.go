@@ -0,0 +1,8 @@
+package cache
+
+// Weigher 计算 entry 的权重，配合 Builder.MaximumWeight 使用
+//
+// 权重在 entry 写入时计算，必须大于等于 0
+type Weigher interface {
+	Weigh(key, value interface{}) int64
+}
@@ -0,0 +1,60 @@
+// Package clock 抽象当前时间及定时器，便于在测试中用可以手动推进的时钟代替真实时间
+//
+// 生产代码使用 System；测试使用 clocktest.FakeClock，通过 Advance 推进时间，不需要真实地等待。
+package clock
+
+import (
+	"time"
+)
+
+// Clock 提供当前时间、周期性的 Ticker 以及一次性的定时器
+type Clock interface {
+	Now() time.Time
+	// NewTicker 返回每隔 d 触发一次的 Ticker，d 必须大于 0
+	NewTicker(d time.Duration) Ticker
+	// After 返回 d 之后收到当前时间的 channel
+	After(d time.Duration) <-chan time.Time
+}
+
+// Ticker 对应 time.Ticker，不再使用时需要调用 Stop
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// System 基于 time 包的真实时钟
+var System Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type systemTicker struct {
+	ticker *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t systemTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// OrSystem c 为 nil 时返回 System，用于未设置 Clock 时的默认值
+func OrSystem(c Clock) Clock {
+	if c == nil {
+		return System
+	}
+	return c
+}
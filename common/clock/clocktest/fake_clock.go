@@ -0,0 +1,146 @@
+// Package clocktest 提供用于测试的 clock.Clock 实现
+package clocktest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vvwyy/peanut/common/clock"
+)
+
+// FakeClock 只在调用 Advance 或 Set 时前进的时钟
+//
+// 推进时间时，到期的 Ticker 和 After 会像 time 包一样收到推进后的时间：
+// channel 的缓冲为 1，接收方来不及接收时丢弃多余的 tick。
+type FakeClock struct {
+	mu      sync.Mutex // protects following fields
+	now     time.Time
+	waiters []*waiter
+	changed chan struct{} // 新增 waiter 时关闭，用于唤醒 BlockUntil
+}
+
+// 等待到期的 Ticker 或者 After
+type waiter struct {
+	deadline time.Time
+	period   time.Duration // Ticker 的周期，After 为 0
+	c        chan time.Time
+}
+
+// NewFakeClock 返回当前时间为 now 的 FakeClock
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now, changed: make(chan struct{})}
+}
+
+func (fake *FakeClock) Now() time.Time {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	return fake.now
+}
+
+func (fake *FakeClock) NewTicker(d time.Duration) clock.Ticker {
+	if d <= 0 {
+		panic("clocktest: non-positive interval for NewTicker")
+	}
+	w := &waiter{period: d, c: make(chan time.Time, 1)}
+	fake.mu.Lock()
+	w.deadline = fake.now.Add(d)
+	fake.addWaiterLocked(w)
+	fake.mu.Unlock()
+	return &fakeTicker{clock: fake, waiter: w}
+}
+
+func (fake *FakeClock) After(d time.Duration) <-chan time.Time {
+	w := &waiter{c: make(chan time.Time, 1)}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	w.deadline = fake.now.Add(d)
+	if d <= 0 {
+		w.c <- fake.now
+		return w.c
+	}
+	fake.addWaiterLocked(w)
+	return w.c
+}
+
+// Advance 将时间推进 d，并触发在此期间到期的 Ticker 和 After
+func (fake *FakeClock) Advance(d time.Duration) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.setLocked(fake.now.Add(d))
+}
+
+// Set 将时间设置为 now，now 早于当前时间时不会触发任何 Ticker 或 After
+func (fake *FakeClock) Set(now time.Time) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.setLocked(now)
+}
+
+// BlockUntil 阻塞直到有 n 个 Ticker 或 After 在等待，用于确认其它 goroutine 已经开始等待之后再推进时间
+func (fake *FakeClock) BlockUntil(n int) {
+	for {
+		fake.mu.Lock()
+		waiting, changed := len(fake.waiters), fake.changed
+		fake.mu.Unlock()
+		if waiting >= n {
+			return
+		}
+		<-changed
+	}
+}
+
+func (fake *FakeClock) setLocked(now time.Time) {
+	fake.now = now
+	remaining := fake.waiters[:0]
+	for _, w := range fake.waiters {
+		if w.deadline.After(now) {
+			remaining = append(remaining, w)
+			continue
+		}
+		select {
+		case w.c <- now:
+		default:
+		}
+		if w.period > 0 {
+			// 与 time.Ticker 一样，跳过来不及触发的 tick
+			for !w.deadline.After(now) {
+				w.deadline = w.deadline.Add(w.period)
+			}
+			remaining = append(remaining, w)
+		}
+	}
+	for i := len(remaining); i < len(fake.waiters); i++ {
+		fake.waiters[i] = nil
+	}
+	fake.waiters = remaining
+}
+
+func (fake *FakeClock) addWaiterLocked(w *waiter) {
+	fake.waiters = append(fake.waiters, w)
+	close(fake.changed)
+	fake.changed = make(chan struct{})
+}
+
+func (fake *FakeClock) removeWaiter(w *waiter) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	for i, waiting := range fake.waiters {
+		if waiting == w {
+			fake.waiters = append(fake.waiters[:i], fake.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+type fakeTicker struct {
+	clock  *FakeClock
+	waiter *waiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.waiter.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.removeWaiter(t.waiter)
+}
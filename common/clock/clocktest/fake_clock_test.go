@@ -0,0 +1,80 @@
+package clocktest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock_After(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := NewFakeClock(start)
+
+	c := fake.After(time.Minute)
+	fake.Advance(59 * time.Second)
+	select {
+	case <-c:
+		t.Fatal("fired before the deadline")
+	default:
+	}
+
+	fake.Advance(time.Second)
+	select {
+	case now := <-c:
+		if !now.Equal(start.Add(time.Minute)) {
+			t.Fatalf("unexpected time %v", now)
+		}
+	default:
+		t.Fatal("not fired after the deadline")
+	}
+
+	// d <= 0 时立即触发
+	select {
+	case <-fake.After(0):
+	default:
+		t.Fatal("not fired immediately")
+	}
+}
+
+func TestFakeClock_Ticker(t *testing.T) {
+	fake := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	ticker := fake.NewTicker(time.Second)
+
+	for i := 0; i < 3; i++ {
+		fake.Advance(time.Second)
+		select {
+		case <-ticker.C():
+		default:
+			t.Fatalf("tick %d missed", i)
+		}
+	}
+
+	// 来不及接收的 tick 被丢弃
+	fake.Advance(5 * time.Second)
+	<-ticker.C()
+	select {
+	case <-ticker.C():
+		t.Fatal("dropped ticks should not be delivered")
+	default:
+	}
+
+	ticker.Stop()
+	fake.Advance(time.Second)
+	select {
+	case <-ticker.C():
+		t.Fatal("stopped ticker fired")
+	default:
+	}
+}
+
+func TestFakeClock_BlockUntil(t *testing.T) {
+	fake := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	fired := make(chan struct{})
+	go func() {
+		<-fake.After(time.Hour)
+		close(fired)
+	}()
+
+	fake.BlockUntil(1)
+	fake.Advance(time.Hour)
+	<-fired
+}
@@ -0,0 +1,151 @@
+package concurrent
+
+import (
+	"sync"
+)
+
+// Bulkhead limits the number of concurrently running tasks of one category,
+// so that a single slow dependency can not monopolise the Executor.
+//
+// At most maxConcurrent tasks run at the same time, at most maxQueue tasks wait
+// for a free slot, further submissions are rejected with BulkheadFullError.
+type Bulkhead struct {
+	name          string
+	maxConcurrent int
+	maxQueue      int
+
+	slots chan struct{}
+
+	mu        sync.Mutex // protects following fields
+	active    int
+	queued    int
+	rejected  int64
+	completed int64
+}
+
+// BulkheadStats is a snapshot of a bulkhead's counters.
+type BulkheadStats struct {
+	Name          string
+	MaxConcurrent int
+	MaxQueue      int
+	Active        int
+	Queued        int
+	Rejected      int64
+	Completed     int64
+}
+
+func newBulkhead(name string, maxConcurrent, maxQueue int) *Bulkhead {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	if maxQueue < 0 {
+		maxQueue = 0
+	}
+	return &Bulkhead{
+		name:          name,
+		maxConcurrent: maxConcurrent,
+		maxQueue:      maxQueue,
+		slots:         make(chan struct{}, maxConcurrent),
+	}
+}
+
+// RegisterBulkhead adds (or replaces) the named bulkhead used by GoIn.
+// Tasks already admitted by a replaced bulkhead keep running on it.
+func (executor *Executor) RegisterBulkhead(name string, maxConcurrent, maxQueue int) {
+	executor.mu.Lock()
+	defer executor.mu.Unlock()
+	if executor.bulkheads == nil {
+		executor.bulkheads = make(map[string]*Bulkhead)
+	}
+	executor.bulkheads[name] = newBulkhead(name, maxConcurrent, maxQueue)
+}
+
+// GoIn submits executable to the named bulkhead. The returned future fails
+// with BulkheadFullError if the bulkhead is full, or BulkheadNotFoundError if
+// no such bulkhead is registered.
+func (executor *Executor) GoIn(name string, executable Executable) Future {
+	bulkhead := executor.bulkhead(name)
+	if bulkhead == nil {
+		return NewFailedFuture(BulkheadNotFoundError)
+	}
+	if !bulkhead.tryEnter() {
+		return NewFailedFuture(BulkheadFullError)
+	}
+
+	f := executor.newTaskFor(executable)
+	go func() {
+		select {
+		case bulkhead.slots <- struct{}{}:
+		case <-f.runnerCtx.Done():
+			// executor shutdown while waiting in queue
+			bulkhead.leave(false)
+			f.setError(f.runnerCtx.Err())
+			return
+		}
+		bulkhead.start()
+		f.Run()
+		<-bulkhead.slots
+		bulkhead.leave(true)
+	}()
+	return f
+}
+
+// BulkheadStats returns the stats of the named bulkhead.
+func (executor *Executor) BulkheadStats(name string) (BulkheadStats, bool) {
+	bulkhead := executor.bulkhead(name)
+	if bulkhead == nil {
+		return BulkheadStats{}, false
+	}
+	return bulkhead.Stats(), true
+}
+
+func (executor *Executor) bulkhead(name string) *Bulkhead {
+	executor.mu.Lock()
+	defer executor.mu.Unlock()
+	return executor.bulkheads[name]
+}
+
+func (bulkhead *Bulkhead) Stats() BulkheadStats {
+	bulkhead.mu.Lock()
+	defer bulkhead.mu.Unlock()
+	return BulkheadStats{
+		Name:          bulkhead.name,
+		MaxConcurrent: bulkhead.maxConcurrent,
+		MaxQueue:      bulkhead.maxQueue,
+		Active:        bulkhead.active,
+		Queued:        bulkhead.queued,
+		Rejected:      bulkhead.rejected,
+		Completed:     bulkhead.completed,
+	}
+}
+
+// tryEnter admits a task into the queue if there is room left
+func (bulkhead *Bulkhead) tryEnter() bool {
+	bulkhead.mu.Lock()
+	defer bulkhead.mu.Unlock()
+	if bulkhead.active+bulkhead.queued >= bulkhead.maxConcurrent+bulkhead.maxQueue {
+		bulkhead.rejected++
+		return false
+	}
+	bulkhead.queued++
+	return true
+}
+
+// start moves an admitted task from the queue to the running ones
+func (bulkhead *Bulkhead) start() {
+	bulkhead.mu.Lock()
+	bulkhead.queued--
+	bulkhead.active++
+	bulkhead.mu.Unlock()
+}
+
+func (bulkhead *Bulkhead) leave(started bool) {
+	bulkhead.mu.Lock()
+	if started {
+		bulkhead.active--
+		bulkhead.completed++
+	} else {
+		bulkhead.queued--
+	}
+	bulkhead.mu.Unlock()
+}
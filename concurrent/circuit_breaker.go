@@ -0,0 +1,268 @@
+package concurrent
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vvwyy/peanut/common/clock"
+)
+
+const (
+	// CLOSED -> OPEN -> HALF_OPEN -> CLOSED
+	//                            -> OPEN
+	CLOSED    = int32(0)
+	OPEN      = int32(1)
+	HALF_OPEN = int32(2)
+)
+
+type CircuitBreakerConfig struct {
+	// rate (0, 1] of failed calls in the sliding window that opens the circuit
+	FailureRateThreshold float64
+	// rate (0, 1] of slow calls in the sliding window that opens the circuit
+	SlowCallRateThreshold float64
+	// calls taking at least SlowCallDuration are slow calls
+	SlowCallDuration time.Duration
+
+	// number of the latest calls the rates are computed over
+	SlidingWindowSize int
+	// rates are not evaluated before MinimumNumberOfCalls calls are recorded
+	MinimumNumberOfCalls int
+
+	// how long the circuit stays open before trying half-open
+	WaitDurationInOpenState time.Duration
+	// number of trial calls permitted in half-open state
+	PermittedCallsInHalfOpenState int
+
+	// measures call durations and the open state, nil means clock.System
+	Clock clock.Clock
+}
+
+func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		FailureRateThreshold:          0.5,
+		SlowCallRateThreshold:         1,
+		SlowCallDuration:              60 * time.Second,
+		SlidingWindowSize:             100,
+		MinimumNumberOfCalls:          100,
+		WaitDurationInOpenState:       60 * time.Second,
+		PermittedCallsInHalfOpenState: 10,
+	}
+}
+
+// CircuitBreaker stops calling a failing downstream: when the failure rate or
+// slow call rate over the sliding window exceeds the threshold, the circuit
+// opens and calls fail fast with CircuitOpenError. After
+// WaitDurationInOpenState a limited number of trial calls decide whether to
+// close the circuit again.
+type CircuitBreaker struct {
+	config CircuitBreakerConfig
+
+	mu       sync.Mutex // protects following fields
+	state    int32
+	openedAt time.Time
+	window   *callWindow
+	// trial calls admitted and finished in half-open state
+	halfOpenPermitted int
+	halfOpenFinished  int
+}
+
+func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
+	if config.SlidingWindowSize < 1 {
+		config.SlidingWindowSize = 1
+	}
+	if config.MinimumNumberOfCalls < 1 {
+		config.MinimumNumberOfCalls = 1
+	}
+	if config.MinimumNumberOfCalls > config.SlidingWindowSize {
+		config.MinimumNumberOfCalls = config.SlidingWindowSize
+	}
+	if config.PermittedCallsInHalfOpenState < 1 {
+		config.PermittedCallsInHalfOpenState = 1
+	}
+	config.Clock = clock.OrSystem(config.Clock)
+	return &CircuitBreaker{
+		config: config,
+		state:  CLOSED,
+		window: newCallWindow(config.SlidingWindowSize),
+	}
+}
+
+func (breaker *CircuitBreaker) State() int32 {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	breaker.tryHalfOpenLocked(breaker.config.Clock.Now())
+	return breaker.state
+}
+
+// Wrap returns an executable that fails with CircuitOpenError without calling
+// executable while the circuit is open.
+func (breaker *CircuitBreaker) Wrap(executable Executable) Executable {
+	return func() (interface{}, error) {
+		if !breaker.tryAcquire() {
+			return nil, CircuitOpenError
+		}
+		return breaker.call(executable)
+	}
+}
+
+// Go submits executable to executor through the breaker. While the circuit is
+// open, the returned future is already failed with CircuitOpenError and
+// executable is never submitted.
+func (breaker *CircuitBreaker) Go(executor *Executor, executable Executable) Future {
+	if !breaker.tryAcquire() {
+		return NewFailedFuture(CircuitOpenError)
+	}
+
+	// a task completed without running executable, e.g. cancelled before it
+	// started, gives its permit back, otherwise a half-open circuit would wait
+	// for the outcome of a trial call forever
+	var started int32 // 1 once executable starts, 2 if it never will
+	f := executor.newTaskFor(func() (interface{}, error) {
+		if !atomic.CompareAndSwapInt32(&started, 0, 1) {
+			return nil, CancellationError
+		}
+		return breaker.call(executable)
+	})
+	f.onDone = func() {
+		if atomic.CompareAndSwapInt32(&started, 0, 2) {
+			breaker.release()
+		}
+	}
+	executor.execute(f)
+	return f
+}
+
+// call runs an acquired executable and records its outcome
+func (breaker *CircuitBreaker) call(executable Executable) (result interface{}, err error) {
+	start := breaker.config.Clock.Now()
+	failed := true
+	defer func() {
+		breaker.record(failed, breaker.config.Clock.Now().Sub(start))
+	}()
+
+	result, err = executable()
+	failed = err != nil
+	return result, err
+}
+
+func (breaker *CircuitBreaker) tryAcquire() bool {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	breaker.tryHalfOpenLocked(breaker.config.Clock.Now())
+	switch breaker.state {
+	case CLOSED:
+		return true
+	case HALF_OPEN:
+		if breaker.halfOpenPermitted < breaker.config.PermittedCallsInHalfOpenState {
+			breaker.halfOpenPermitted++
+			return true
+		}
+	}
+	return false
+}
+
+// release gives back a permit acquired for a call that never ran
+func (breaker *CircuitBreaker) release() {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	if breaker.state == HALF_OPEN && breaker.halfOpenPermitted > breaker.halfOpenFinished {
+		breaker.halfOpenPermitted--
+	}
+}
+
+func (breaker *CircuitBreaker) record(failed bool, elapsed time.Duration) {
+	slow := breaker.config.SlowCallDuration > 0 && elapsed >= breaker.config.SlowCallDuration
+
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	switch breaker.state {
+	case CLOSED:
+		breaker.window.add(failed, slow)
+		if breaker.window.size >= breaker.config.MinimumNumberOfCalls && breaker.exceedsThresholdsLocked() {
+			breaker.transitionLocked(OPEN)
+		}
+	case HALF_OPEN:
+		breaker.window.add(failed, slow)
+		breaker.halfOpenFinished++
+		if breaker.halfOpenFinished < breaker.config.PermittedCallsInHalfOpenState {
+			return
+		}
+		if breaker.exceedsThresholdsLocked() {
+			breaker.transitionLocked(OPEN)
+		} else {
+			breaker.transitionLocked(CLOSED)
+		}
+	}
+	// calls finishing after the circuit opened are ignored
+}
+
+func (breaker *CircuitBreaker) exceedsThresholdsLocked() bool {
+	size := float64(breaker.window.size)
+	if breaker.config.FailureRateThreshold > 0 && float64(breaker.window.failures)/size >= breaker.config.FailureRateThreshold {
+		return true
+	}
+	if breaker.config.SlowCallRateThreshold > 0 && float64(breaker.window.slows)/size >= breaker.config.SlowCallRateThreshold {
+		return true
+	}
+	return false
+}
+
+func (breaker *CircuitBreaker) tryHalfOpenLocked(now time.Time) {
+	if breaker.state == OPEN && now.Sub(breaker.openedAt) >= breaker.config.WaitDurationInOpenState {
+		breaker.transitionLocked(HALF_OPEN)
+	}
+}
+
+func (breaker *CircuitBreaker) transitionLocked(state int32) {
+	breaker.state = state
+	breaker.window = newCallWindow(breaker.config.SlidingWindowSize)
+	breaker.halfOpenPermitted = 0
+	breaker.halfOpenFinished = 0
+	if state == OPEN {
+		breaker.openedAt = breaker.config.Clock.Now()
+	}
+}
+
+// callWindow is a count based sliding window over the latest call outcomes
+type callWindow struct {
+	failedCalls []bool
+	slowCalls   []bool
+	next        int
+	size        int
+	failures    int
+	slows       int
+}
+
+func newCallWindow(capacity int) *callWindow {
+	return &callWindow{
+		failedCalls: make([]bool, capacity),
+		slowCalls:   make([]bool, capacity),
+	}
+}
+
+func (window *callWindow) add(failed, slow bool) {
+	if window.size == len(window.failedCalls) {
+		// evict the oldest outcome
+		if window.failedCalls[window.next] {
+			window.failures--
+		}
+		if window.slowCalls[window.next] {
+			window.slows--
+		}
+	} else {
+		window.size++
+	}
+	window.failedCalls[window.next] = failed
+	window.slowCalls[window.next] = slow
+	if failed {
+		window.failures++
+	}
+	if slow {
+		window.slows++
+	}
+	window.next = (window.next + 1) % len(window.failedCalls)
+}
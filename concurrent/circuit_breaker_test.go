@@ -0,0 +1,180 @@
+package concurrent
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vvwyy/peanut/common/clock/clocktest"
+)
+
+func newTestCircuitBreaker() *CircuitBreaker {
+	return NewCircuitBreaker(CircuitBreakerConfig{
+		FailureRateThreshold:          0.5,
+		SlowCallRateThreshold:         1,
+		SlowCallDuration:              200 * time.Millisecond,
+		SlidingWindowSize:             4,
+		MinimumNumberOfCalls:          4,
+		WaitDurationInOpenState:       300 * time.Millisecond,
+		PermittedCallsInHalfOpenState: 2,
+	})
+}
+
+func TestCircuitBreaker_Go(t *testing.T) {
+	executor := NewExecutor()
+	breaker := newTestCircuitBreaker()
+
+	failing := func() (interface{}, error) {
+		return nil, errors.New("some error")
+	}
+	for i := 0; i < 4; i++ {
+		breaker.Go(executor, failing).Get()
+	}
+	if breaker.State() != OPEN {
+		t.FailNow()
+	}
+
+	called := false
+	_, err := breaker.Go(executor, func() (interface{}, error) {
+		called = true
+		return "Executable", nil
+	}).Get()
+	if err != CircuitOpenError || called {
+		t.Logf("open circuit should fail fast. Err: %v", err)
+		t.FailNow()
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if breaker.State() != HALF_OPEN {
+		t.FailNow()
+	}
+
+	succeeding := func() (interface{}, error) {
+		return "Executable", nil
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := breaker.Go(executor, succeeding).Get(); err != nil {
+			t.Logf("future get result failed. Err: %s", err)
+			t.FailNow()
+		}
+	}
+	if breaker.State() != CLOSED {
+		t.FailNow()
+	}
+}
+
+func TestCircuitBreaker_SlowCalls(t *testing.T) {
+	breaker := newTestCircuitBreaker()
+
+	slow := breaker.Wrap(func() (interface{}, error) {
+		time.Sleep(200 * time.Millisecond)
+		return "Executable", nil
+	})
+	for i := 0; i < 4; i++ {
+		if _, err := slow(); err != nil {
+			t.FailNow()
+		}
+	}
+	if breaker.State() != OPEN {
+		t.FailNow()
+	}
+	if _, err := slow(); err != CircuitOpenError {
+		t.FailNow()
+	}
+}
+
+func TestCircuitBreaker_FakeClock(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{
+		FailureRateThreshold:          0.5,
+		SlowCallRateThreshold:         1,
+		SlowCallDuration:              time.Minute,
+		SlidingWindowSize:             2,
+		MinimumNumberOfCalls:          2,
+		WaitDurationInOpenState:       time.Hour,
+		PermittedCallsInHalfOpenState: 1,
+		Clock:                         fakeClock,
+	})
+
+	// calls are slow when the clock advances past SlowCallDuration during the call
+	slow := breaker.Wrap(func() (interface{}, error) {
+		fakeClock.Advance(time.Minute)
+		return "Executable", nil
+	})
+	for i := 0; i < 2; i++ {
+		if _, err := slow(); err != nil {
+			t.FailNow()
+		}
+	}
+	if breaker.State() != OPEN {
+		t.FailNow()
+	}
+
+	fakeClock.Advance(time.Hour - time.Second)
+	if breaker.State() != OPEN {
+		t.FailNow()
+	}
+	fakeClock.Advance(time.Second)
+	if breaker.State() != HALF_OPEN {
+		t.FailNow()
+	}
+
+	succeeding := breaker.Wrap(func() (interface{}, error) {
+		return "Executable", nil
+	})
+	if _, err := succeeding(); err != nil {
+		t.FailNow()
+	}
+	if breaker.State() != CLOSED {
+		t.FailNow()
+	}
+}
+
+func TestCircuitBreaker_CancelledTrial(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	executor := NewExecutor()
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{
+		FailureRateThreshold:          0.5,
+		SlidingWindowSize:             2,
+		MinimumNumberOfCalls:          2,
+		WaitDurationInOpenState:       time.Hour,
+		PermittedCallsInHalfOpenState: 1,
+		Clock:                         fakeClock,
+	})
+
+	failing := breaker.Wrap(func() (interface{}, error) {
+		return nil, errors.New("some error")
+	})
+	for i := 0; i < 2; i++ {
+		failing()
+	}
+	fakeClock.Advance(time.Hour)
+	if breaker.State() != HALF_OPEN {
+		t.FailNow()
+	}
+
+	// the only trial call is cancelled, it either never runs and gives its
+	// permit back, or runs and closes the circuit
+	f := breaker.Go(executor, func() (interface{}, error) {
+		return "Executable", nil
+	})
+	f.Cancel(false)
+
+	succeeding := breaker.Wrap(func() (interface{}, error) {
+		return "Executable", nil
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := succeeding(); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Log("circuit should admit a trial call after the cancelled one")
+			t.FailNow()
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if breaker.State() != CLOSED {
+		t.FailNow()
+	}
+}
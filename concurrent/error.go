@@ -7,4 +7,34 @@ var (
 	CancellationError = errors.New("goroutine is cancelled")
 	ExecutionError    = errors.New("goroutine execute error")
 	TimeoutError      = errors.New("timeout")
+
+	BulkheadFullError     = errors.New("bulkhead is full")
+	BulkheadNotFoundError = errors.New("bulkhead not found")
+
+	CircuitOpenError = errors.New("circuit breaker is open")
 )
+
+// cancelledError is returned by Get when a task was cancelled with a cause,
+// errors.Is matches both CancellationError and the cause.
+type cancelledError struct {
+	cause error
+}
+
+func cancellationError(cause error) error {
+	if cause == nil {
+		return CancellationError
+	}
+	return &cancelledError{cause: cause}
+}
+
+func (err *cancelledError) Error() string {
+	return CancellationError.Error() + ": " + err.cause.Error()
+}
+
+func (err *cancelledError) Is(target error) bool {
+	return target == CancellationError
+}
+
+func (err *cancelledError) Unwrap() error {
+	return err.cause
+}
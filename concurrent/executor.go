@@ -2,11 +2,18 @@ package concurrent
 
 import (
 	"context"
+	"sync"
+
+	"github.com/vvwyy/peanut/common/clock"
 )
 
 type Executor struct {
 	ctx    context.Context
 	cancel context.CancelFunc
+	clock  clock.Clock // timeouts of the futures, nil means clock.System
+
+	mu        sync.Mutex // protects following fields
+	bulkheads map[string]*Bulkhead
 }
 
 func NewExecutor() *Executor {
@@ -17,14 +24,37 @@ func NewExecutor() *Executor {
 	}
 }
 
+// NewExecutorWithClock returns an executor whose futures measure
+// GetWithTimeout with c, so that tests can time out futures by advancing a
+// fake clock instead of waiting.
+func NewExecutorWithClock(c clock.Clock) *Executor {
+	executor := NewExecutor()
+	executor.clock = c
+	return executor
+}
+
 func (executor *Executor) Go(executable Executable) Future {
 	f := executor.newTaskFor(executable)
 	executor.execute(f)
 	return f
 }
 
+// GoDerived submits executable as a future derived from parent. When
+// propagateCancel is true, cancelling parent also cancels the derived future
+// with the same cause.
+func (executor *Executor) GoDerived(parent Future, propagateCancel bool, executable Executable) Future {
+	f := executor.newTaskFor(executable)
+	if p, ok := parent.(*FutureTask); ok && propagateCancel {
+		p.addDependent(f)
+	}
+	executor.execute(f)
+	return f
+}
+
 func (executor *Executor) newTaskFor(executable Executable) *FutureTask {
-	return NewFutureTask(executor.ctx, executable)
+	f := NewFutureTask(executor.ctx, executable)
+	f.clock = executor.clock
+	return f
 }
 
 func (executor *Executor) execute(f ExecutableFuture) {
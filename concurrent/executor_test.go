@@ -6,6 +6,8 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/vvwyy/peanut/common/clock/clocktest"
 )
 
 func TestExecutor_Go(t *testing.T) {
@@ -101,7 +103,7 @@ func TestExecutor_Go_3(t *testing.T) {
 		ret, err := f.Get()
 		if err != nil {
 			t.Logf("[GO] future get result failed. Err: %s", err)
-			t.FailNow()
+			t.Fail()
 		}
 		fmt.Println("[GO] future.Get(), result is : ", ret)
 	}()
@@ -129,7 +131,7 @@ func TestExecutor_Go_4(t *testing.T) {
 		ret, err := f.Get()
 		if err != nil {
 			t.Logf("[GO] future get result failed. Err: %s", err)
-			t.FailNow()
+			t.Fail()
 		}
 		fmt.Println("[GO] future.Get(), result is : ", ret)
 	}()
@@ -138,7 +140,7 @@ func TestExecutor_Go_4(t *testing.T) {
 		ret, err := f.Get()
 		if err != nil {
 			t.Logf("[GO] future get result failed. Err: %s", err)
-			t.FailNow()
+			t.Fail()
 		}
 		fmt.Println("[GO] future.Get(), result is : ", ret)
 	}()
@@ -208,7 +210,7 @@ func TestExecutor_Go_7(t *testing.T) {
 		if err != nil {
 			t.Logf("[Go] future get result is timeout. Err: %s", err)
 		} else {
-			t.FailNow()
+			t.Fail()
 		}
 	}()
 
@@ -371,7 +373,6 @@ func TestExecutor_Go_14(t *testing.T) {
 
 	executable := func() (interface{}, error) {
 		panic("Some panic")
-		return "Executable", nil
 	}
 
 	f := executor.Go(executable)
@@ -404,7 +405,7 @@ func TestExecutor_Go_15(t *testing.T) {
 		go func(f Future) {
 			ret, err := f.Get()
 			if err != nil {
-				t.FailNow()
+				t.Fail()
 			} else {
 				t.Logf("result is: %s", ret)
 			}
@@ -413,3 +414,276 @@ func TestExecutor_Go_15(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestExecutor_Go_16(t *testing.T) {
+	executor := NewExecutor()
+
+	executable := func() (interface{}, error) {
+		return nil, nil
+	}
+
+	f := executor.Go(executable)
+
+	ret, err := f.GetWithTimeout(1 * time.Second)
+	if err != nil {
+		t.Logf("future get nil result failed. Err: %s", err)
+		t.FailNow()
+	}
+	if ret != nil {
+		t.FailNow()
+	}
+	if !f.IsDone() || f.IsCancelled() {
+		t.FailNow()
+	}
+
+	ret, err = f.Get()
+	if err != nil || ret != nil {
+		t.FailNow()
+	}
+}
+
+func TestExecutor_Go_17(t *testing.T) {
+	executor := NewExecutor()
+
+	executable := func() (interface{}, error) {
+		panic(nil)
+	}
+
+	f := executor.Go(executable)
+
+	_, err := f.GetWithTimeout(1 * time.Second)
+	if err == nil || err == TimeoutError {
+		t.Logf("panic(nil) should fail the future. Err: %v", err)
+		t.FailNow()
+	}
+}
+
+func TestExecutor_Go_18(t *testing.T) {
+	executor := NewExecutor()
+
+	executable := func() (interface{}, error) {
+		time.Sleep(1 * time.Second)
+		return "Executable", nil
+	}
+
+	f := executor.Go(executable)
+
+	cause := errors.New("user aborted")
+	if !f.CancelWithCause(cause) {
+		t.FailNow()
+	}
+
+	_, err := f.Get()
+	if !errors.Is(err, CancellationError) || !errors.Is(err, cause) {
+		t.Logf("future get should wrap cause. Err: %v", err)
+		t.FailNow()
+	}
+	if !f.IsCancelled() {
+		t.FailNow()
+	}
+}
+
+func TestExecutor_Go_19(t *testing.T) {
+	executor := NewExecutor()
+
+	executable := func() (interface{}, error) {
+		time.Sleep(1 * time.Second)
+		return "Executable", nil
+	}
+
+	parent := executor.Go(executable)
+	propagated := executor.GoDerived(parent, true, executable)
+	detached := executor.GoDerived(parent, false, executable)
+
+	cause := errors.New("parent aborted")
+	parent.CancelWithCause(cause)
+
+	_, err := propagated.GetWithTimeout(500 * time.Millisecond)
+	if !errors.Is(err, cause) {
+		t.Logf("derived future should be cancelled with parent cause. Err: %v", err)
+		t.FailNow()
+	}
+
+	ret, err := detached.Get()
+	if err != nil {
+		t.Logf("detached future should not be cancelled. Err: %s", err)
+		t.FailNow()
+	}
+	fmt.Println("future.Get(), result is : ", ret)
+
+	// deriving from an already cancelled future cancels immediately
+	late := executor.GoDerived(parent, true, executable)
+	if !late.IsCancelled() {
+		t.FailNow()
+	}
+}
+
+func TestTaskGroup_Wait(t *testing.T) {
+	executor := NewExecutor()
+	group := executor.NewGroup()
+
+	someError := errors.New("some error")
+	slow := group.Go(func() (interface{}, error) {
+		time.Sleep(2 * time.Second)
+		return "Executable", nil
+	})
+	group.Go(func() (interface{}, error) {
+		time.Sleep(100 * time.Millisecond)
+		return nil, someError
+	})
+
+	if err := group.Wait(); err != someError {
+		t.Logf("group wait should return the first error. Err: %v", err)
+		t.FailNow()
+	}
+	if !slow.IsCancelled() {
+		t.FailNow()
+	}
+}
+
+func TestTaskGroup_Cancel(t *testing.T) {
+	executor := NewExecutor()
+	group := executor.NewGroup()
+	sub := group.NewGroup()
+	other := executor.NewGroup()
+
+	executable := func() (interface{}, error) {
+		time.Sleep(1 * time.Second)
+		return "Executable", nil
+	}
+
+	f1 := group.Go(executable)
+	f2 := sub.Go(executable)
+	f3 := other.Go(executable)
+
+	group.Cancel()
+
+	if _, err := f1.Get(); !errors.Is(err, CancellationError) {
+		t.FailNow()
+	}
+	if _, err := f2.Get(); !errors.Is(err, CancellationError) {
+		t.FailNow()
+	}
+	if !group.Go(executable).IsCancelled() {
+		t.FailNow()
+	}
+
+	ret, err := f3.Get()
+	if err != nil {
+		t.Logf("other group should not be cancelled. Err: %s", err)
+		t.FailNow()
+	}
+	fmt.Println("future.Get(), result is : ", ret)
+	if err := other.Wait(); err != nil {
+		t.FailNow()
+	}
+	// tasks cancelled by the group are not errors
+	if err := group.Wait(); err != nil {
+		t.Logf("cancelled group should wait without error. Err: %v", err)
+		t.FailNow()
+	}
+}
+
+func TestTaskGroup_Finished(t *testing.T) {
+	executor := NewExecutor()
+	group := executor.NewGroup()
+
+	for i := 0; i < 100; i++ {
+		group.Go(func() (interface{}, error) {
+			return "Executable", nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		t.FailNow()
+	}
+
+	// finished tasks are released by the group
+	group.mu.Lock()
+	unfinished := len(group.futures)
+	group.mu.Unlock()
+	if unfinished != 0 {
+		t.Logf("expected no unfinished tasks, got %d", unfinished)
+		t.FailNow()
+	}
+}
+
+func TestExecutor_GoIn(t *testing.T) {
+	executor := NewExecutor()
+	executor.RegisterBulkhead("payments", 1, 1)
+
+	executable := func() (interface{}, error) {
+		time.Sleep(500 * time.Millisecond)
+		return "Executable", nil
+	}
+
+	running := executor.GoIn("payments", executable)
+	queued := executor.GoIn("payments", executable)
+	rejected := executor.GoIn("payments", executable)
+
+	if _, err := rejected.Get(); err != BulkheadFullError {
+		t.Logf("bulkhead should reject when full. Err: %v", err)
+		t.FailNow()
+	}
+	if _, err := executor.GoIn("unknown", executable).Get(); err != BulkheadNotFoundError {
+		t.FailNow()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	stats, ok := executor.BulkheadStats("payments")
+	if !ok || stats.Active != 1 || stats.Queued != 1 || stats.Rejected != 1 {
+		t.Logf("unexpected bulkhead stats: %+v", stats)
+		t.FailNow()
+	}
+
+	for _, f := range []Future{running, queued} {
+		if _, err := f.Get(); err != nil {
+			t.Logf("future get result failed. Err: %s", err)
+			t.FailNow()
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	stats, _ = executor.BulkheadStats("payments")
+	if stats.Active != 0 || stats.Queued != 0 || stats.Completed != 2 {
+		t.Logf("unexpected bulkhead stats: %+v", stats)
+		t.FailNow()
+	}
+}
+
+func TestExecutor_GetWithTimeoutFakeClock(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	executor := NewExecutorWithClock(fakeClock)
+	defer executor.Shutdown()
+
+	release := make(chan struct{})
+	f := executor.Go(func() (interface{}, error) {
+		<-release
+		return "Executable", nil
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := f.GetWithTimeout(time.Hour)
+		done <- err
+	}()
+
+	// the waiter times out once the fake clock passes the deadline
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(time.Hour)
+	select {
+	case err := <-done:
+		if err != TimeoutError {
+			t.Logf("expected timeout. Err: %v", err)
+			t.FailNow()
+		}
+	case <-time.After(5 * time.Second):
+		t.Log("GetWithTimeout did not time out after advancing the clock")
+		t.FailNow()
+	}
+
+	close(release)
+	ret, err := f.Get()
+	if err != nil || ret != "Executable" {
+		t.FailNow()
+	}
+}
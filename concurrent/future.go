@@ -12,6 +12,7 @@ type Executable func () (interface{}, error)
 
 type Future interface {
 	Cancel(mayInterruptIfRunning bool) bool
+	CancelWithCause(cause error) bool
 	IsCancelled() bool
 	IsDone() bool
 	Get() (interface{}, error)
@@ -7,7 +7,8 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
-	"unsafe"
+
+	"github.com/vvwyy/peanut/common/clock"
 )
 
 const (
@@ -27,15 +28,24 @@ const (
 
 type FutureTask struct {
 	mu         sync.Mutex // protects following fields
-	state      int32
+	state      int32      // also read without the lock, always accessed atomically
 	executable Executable
 	waiters    *WaitNode
 
 	runnerCtx    context.Context
 	runnerCancel context.CancelFunc
 
+	clock clock.Clock // measures GetWithTimeout, nil means clock.System
+
 	err    error
 	result interface{}
+	cause  error // reason of cancellation, may be nil
+
+	// futures which should be cancelled together with this one
+	dependents []*FutureTask
+	completed  bool // set by finishCompletion
+
+	onDone func() // called once the task is completed, normally or not
 }
 
 func NewFutureTask(parentCtx context.Context, executable Executable) *FutureTask {
@@ -50,13 +60,25 @@ func NewFutureTask(parentCtx context.Context, executable Executable) *FutureTask
 	return f
 }
 
+// NewFailedFuture returns a future that is already completed with err.
+func NewFailedFuture(err error) *FutureTask {
+	f := NewFutureTask(context.Background(), nil)
+	if err == nil {
+		err = ExecutionError
+	}
+	f.setError(err)
+	return f
+}
+
 func (futureTask *FutureTask) Run() {
 	if futureTask.runnerCtx == nil {
 		return
 	}
 
+	futureTask.mu.Lock()
 	e := futureTask.executable
-	if e == nil || futureTask.state != NEW {
+	futureTask.mu.Unlock()
+	if e == nil || futureTask.loadState() != NEW {
 		return
 	}
 
@@ -73,6 +95,7 @@ func (futureTask *FutureTask) Run() {
 		if err != nil {
 			c <- err
 		} else {
+			// result may be nil, which is still a successful completion
 			futureTask.setResult(result)
 			c <- nil
 		}
@@ -87,14 +110,24 @@ func (futureTask *FutureTask) Run() {
 		}
 	}
 
-	state := futureTask.state
+	state := futureTask.loadState()
 	if state >= INTERRUPTING {
 		futureTask.handlePossibleCancellationInterrupt(state)
 	}
 }
 
 func (futureTask *FutureTask) Cancel(mayInterruptIfRunning bool) bool {
-	if futureTask.state != NEW {
+	return futureTask.cancel(mayInterruptIfRunning, nil)
+}
+
+// CancelWithCause interrupts the task like Cancel(true) and records cause,
+// Get then returns an error wrapping both CancellationError and cause.
+func (futureTask *FutureTask) CancelWithCause(cause error) bool {
+	return futureTask.cancel(true, cause)
+}
+
+func (futureTask *FutureTask) cancel(mayInterruptIfRunning bool, cause error) bool {
+	if futureTask.loadState() != NEW {
 		return false
 	}
 	newState := CANCELLED
@@ -104,36 +137,48 @@ func (futureTask *FutureTask) Cancel(mayInterruptIfRunning bool) bool {
 	if !atomic.CompareAndSwapInt32(&futureTask.state, NEW, newState) {
 		return false
 	}
+	futureTask.mu.Lock()
+	futureTask.result = nil
+	futureTask.err = cancellationError(cause)
+	futureTask.cause = cause
+	if mayInterruptIfRunning {
+		atomic.StoreInt32(&futureTask.state, INTERRUPTED)
+	}
+	dependents := futureTask.dependents
+	futureTask.dependents = nil
+	futureTask.finishCompletion()
+	futureTask.mu.Unlock()
+
 	if mayInterruptIfRunning {
 		// interrupt current task
 		// Thinking: actually ctx cancel is not work well
 		futureTask.runnerCancel()
+	}
 
-		futureTask.mu.Lock()
-		futureTask.state = INTERRUPTED
-		futureTask.result = nil
-		futureTask.err = CancellationError
-		futureTask.finishCompletion()
-		futureTask.mu.Unlock()
+	// propagate to dependent futures outside of the lock
+	for _, dependent := range dependents {
+		dependent.cancel(mayInterruptIfRunning, cause)
 	}
 	return true
 }
 
 func (futureTask *FutureTask) IsCancelled() bool {
-	return futureTask.state >= CANCELLED
+	return futureTask.loadState() >= CANCELLED
 }
 
 func (futureTask *FutureTask) IsDone() bool {
-	return futureTask.state != NEW
+	return futureTask.loadState() != NEW
 }
 
 func (futureTask *FutureTask) Err() error {
+	futureTask.mu.Lock()
+	defer futureTask.mu.Unlock()
 	return futureTask.err
 }
 
 func (futureTask *FutureTask) Get() (interface{}, error) {
-	s := futureTask.state
-	if s <= COMPLETING {
+	s := futureTask.loadState()
+	if s <= COMPLETING || s == INTERRUPTING {
 		var err error
 		s, err = futureTask.awaitDone(false, 0)
 		if err != nil {
@@ -144,14 +189,14 @@ func (futureTask *FutureTask) Get() (interface{}, error) {
 }
 
 func (futureTask *FutureTask) GetWithTimeout(d time.Duration) (interface{}, error) {
-	s := futureTask.state
-	if s <= COMPLETING {
+	s := futureTask.loadState()
+	if s <= COMPLETING || s == INTERRUPTING {
 		var err error
 		s, err = futureTask.awaitDone(true, d)
 		if err != nil {
 			return nil, err
 		}
-		if s <= COMPLETING {
+		if s <= COMPLETING || s == INTERRUPTING {
 			return nil, TimeoutError
 		}
 	}
@@ -160,19 +205,30 @@ func (futureTask *FutureTask) GetWithTimeout(d time.Duration) (interface{}, erro
 
 // ---------------------------------------------------------------------------------------------------------------------
 
+// state is written by CAS or atomic stores and may be read without the lock
+func (futureTask *FutureTask) loadState() int32 {
+	return atomic.LoadInt32(&futureTask.state)
+}
+
 func (futureTask *FutureTask) createWithCancel() (context.Context, context.CancelFunc) {
 	return context.WithCancel(futureTask.runnerCtx)
 }
 
 func (futureTask *FutureTask) report(state int32) (interface{}, error) {
 	// Thinking: whether need to check status
+	// result and err of a cancelled task are set after its state, read them under the lock
+	futureTask.mu.Lock()
 	ret := futureTask.result
 	err := futureTask.err
+	futureTask.mu.Unlock()
 	if state == NORMAL {
 		return ret, nil
 	}
 	if state >= CANCELLED {
-		return nil, CancellationError
+		if err == nil {
+			return nil, CancellationError
+		}
+		return nil, err
 	}
 	if err == nil {
 		return nil, ExecutionError
@@ -180,6 +236,24 @@ func (futureTask *FutureTask) report(state int32) (interface{}, error) {
 	return nil, err
 }
 
+// addDependent registers dependent to be cancelled when this task is cancelled.
+// If this task is already cancelled, dependent is cancelled immediately.
+func (futureTask *FutureTask) addDependent(dependent *FutureTask) {
+	futureTask.mu.Lock()
+	if !futureTask.completed {
+		futureTask.dependents = append(futureTask.dependents, dependent)
+		futureTask.mu.Unlock()
+		return
+	}
+	state := futureTask.loadState()
+	cause := futureTask.cause
+	futureTask.mu.Unlock()
+
+	if state >= CANCELLED {
+		dependent.cancel(state >= INTERRUPTING, cause)
+	}
+}
+
 func (futureTask *FutureTask) setError(err error) {
 	if err == nil {
 		return
@@ -187,22 +261,20 @@ func (futureTask *FutureTask) setError(err error) {
 	if atomic.CompareAndSwapInt32(&futureTask.state, NEW, COMPLETING) {
 		futureTask.mu.Lock()
 		futureTask.err = err
-		futureTask.state = ERROR
 		futureTask.result = nil
+		atomic.StoreInt32(&futureTask.state, ERROR)
 		futureTask.finishCompletion()
 		futureTask.mu.Unlock()
 	}
 }
 
+// nil is a legitimate result: an executable returning (nil, nil) completes NORMAL
 func (futureTask *FutureTask) setResult(ret interface{}) {
-	if ret == nil {
-		return
-	}
 	if atomic.CompareAndSwapInt32(&futureTask.state, NEW, COMPLETING) {
 		futureTask.mu.Lock()
 		futureTask.err = nil
-		futureTask.state = NORMAL
 		futureTask.result = ret
+		atomic.StoreInt32(&futureTask.state, NORMAL)
 		futureTask.finishCompletion()
 		futureTask.mu.Unlock()
 	}
@@ -220,70 +292,66 @@ type WaitNode struct {
 	next   *WaitNode
 }
 
-// Removes and signals all waiting goroutine
+// Removes and signals all waiting goroutine, called with mu held
 func (futureTask *FutureTask) finishCompletion() {
-	for node := futureTask.waiters; node != nil; {
-		if atomic.CompareAndSwapUintptr((*uintptr)(unsafe.Pointer(&futureTask.waiters)), uintptr(unsafe.Pointer(node)), uintptr(unsafe.Pointer(nil))) {
-			for {
-				// signals waiting goroutine
-				node.cancel()
-				nextNode := node.next
-				if nextNode == nil {
-					break
-				}
-				node.next = nil
-				node = nextNode
-			}
-			break
-		}
+	for node := futureTask.waiters; node != nil; node = node.next {
+		// signals waiting goroutine
+		node.cancel()
 	}
+	futureTask.waiters = nil
 	futureTask.done()
 	futureTask.executable = nil
+	futureTask.dependents = nil
+	futureTask.completed = true
 }
 
 func (futureTask *FutureTask) done() {
-	// nothing to do currently
+	if futureTask.onDone != nil {
+		futureTask.onDone()
+	}
 }
 
 // Awaits completion or aborts on interrupt or timeout.
 func (futureTask *FutureTask) awaitDone(timed bool, nanos time.Duration) (int32, error) {
-	var deadline = time.Now()
+	c := clock.OrSystem(futureTask.clock)
+	var deadline = c.Now()
 	if timed {
 		deadline = deadline.Add(nanos)
 	}
 
 	queued := false
 	var q *WaitNode = nil
+	defer func() {
+		if q != nil {
+			q.cancel()
+		}
+	}()
 	for {
-		if futureTask.runnerCtx.Err() != nil {
-			return NIL, InterruptedError
+		s := futureTask.loadState()
+		if s > COMPLETING && s != INTERRUPTING {
+			return s, nil
 		}
 
-		s := futureTask.state
-		if s > COMPLETING {
-			if q != nil {
-				q.gotx = nil
-			}
-			return s, nil
-		} else if s == COMPLETING {
+		if s == COMPLETING || s == INTERRUPTING {
 			// need to yield
 			time.Sleep(10 * time.Microsecond)
+		} else if futureTask.runnerCtx.Err() != nil {
+			return NIL, InterruptedError
 		} else if q == nil {
 			ctx, cancelFunc := futureTask.createWithCancel()
 			q = &WaitNode{gotx: ctx, cancel: cancelFunc}
 		} else if !queued {
-			q.next = futureTask.waiters
-			queued = atomic.CompareAndSwapUintptr((*uintptr)(unsafe.Pointer(&futureTask.waiters)), uintptr(unsafe.Pointer(futureTask.waiters)), uintptr(unsafe.Pointer(q)))
+			queued = futureTask.addWaiter(q)
 		} else if timed {
-			nanos = deadline.Sub(time.Now())
+			nanos = deadline.Sub(c.Now())
 			if nanos <= 0 {
 				futureTask.removeWaiter(q)
-				return futureTask.state, nil
+				return futureTask.loadState(), nil
 			}
 			select {
 			case <-q.gotx.Done():
 				break
-			case <-time.After(nanos * time.Nanosecond):
+			case <-c.After(nanos * time.Nanosecond):
 				// timeout
 			}
 		} else {
@@ -296,32 +364,27 @@ func (futureTask *FutureTask) awaitDone(timed bool, nanos time.Duration) (int32,
 	}
 }
 
-// Tries to unlink a timed-out or interrupted wait node
-func (futureTask *FutureTask) removeWaiter(node *WaitNode) {
-	if node == nil {
-		return
+// addWaiter queues node to be signaled on completion, returns false when
+// the task is already completed
+func (futureTask *FutureTask) addWaiter(node *WaitNode) bool {
+	futureTask.mu.Lock()
+	defer futureTask.mu.Unlock()
+	if futureTask.completed {
+		return false
 	}
-	node.gotx = nil
-	// Thinking:
-retry:
-	for {
-		var pred *WaitNode
-		var s *WaitNode
-		for q := futureTask.waiters; q != nil; q = s {
-			s = q.next
-			if q.gotx != nil {
-				pred = q
-			} else if pred != nil {
-				pred.next = s
-				if pred.gotx == nil { // check for race
-					continue retry
-				}
-			} else {
-				if !atomic.CompareAndSwapUintptr((*uintptr)(unsafe.Pointer(&q)), uintptr(unsafe.Pointer(q)), uintptr(unsafe.Pointer(s))) {
-					continue retry
-				}
-			}
+	node.next = futureTask.waiters
+	futureTask.waiters = node
+	return true
+}
+
+// Unlinks a timed-out wait node
+func (futureTask *FutureTask) removeWaiter(node *WaitNode) {
+	futureTask.mu.Lock()
+	defer futureTask.mu.Unlock()
+	for p := &futureTask.waiters; *p != nil; p = &(*p).next {
+		if *p == node {
+			*p = node.next
+			return
 		}
-		break
 	}
 }
@@ -0,0 +1,138 @@
+package concurrent
+
+import (
+	"context"
+	"sync"
+
+	"github.com/vvwyy/peanut/common/clock"
+)
+
+// TaskGroup scopes a batch of tasks submitted to an Executor.
+//
+// Tasks of a group share a child context of the executor (or of the parent
+// group), so Cancel only affects this group and its sub groups, while
+// Executor.Shutdown still cancels every group.
+// Wait blocks until all tasks are finished and returns the first error, the
+// same as errgroup: the first failed task cancels the rest of the group.
+// Tasks cancelled by the group itself are not errors, so Wait returns nil
+// after an explicit Cancel unless some task failed.
+type TaskGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	clock  clock.Clock // clock of the executor
+
+	wg sync.WaitGroup
+
+	mu        sync.Mutex               // protects following fields
+	futures   map[*FutureTask]struct{} // unfinished tasks
+	children  []*TaskGroup
+	err       error
+	cancelled bool
+}
+
+func newTaskGroup(parentCtx context.Context, c clock.Clock) *TaskGroup {
+	ctx, cancel := context.WithCancel(parentCtx)
+	return &TaskGroup{
+		ctx:     ctx,
+		cancel:  cancel,
+		clock:   c,
+		futures: make(map[*FutureTask]struct{}),
+	}
+}
+
+// NewGroup creates a task group scoped to this executor.
+func (executor *Executor) NewGroup() *TaskGroup {
+	return newTaskGroup(executor.ctx, executor.clock)
+}
+
+// NewGroup creates a sub group, which is cancelled together with this group.
+func (group *TaskGroup) NewGroup() *TaskGroup {
+	child := newTaskGroup(group.ctx, group.clock)
+
+	group.mu.Lock()
+	cancelled := group.cancelled
+	if !cancelled {
+		group.children = append(group.children, child)
+	}
+	group.mu.Unlock()
+
+	if cancelled {
+		child.Cancel()
+	}
+	return child
+}
+
+func (group *TaskGroup) Go(executable Executable) Future {
+	f := NewFutureTask(group.ctx, executable)
+	f.clock = group.clock
+
+	group.mu.Lock()
+	cancelled := group.cancelled
+	if !cancelled {
+		group.futures[f] = struct{}{}
+	}
+	group.mu.Unlock()
+
+	if cancelled {
+		f.Cancel(false)
+	}
+
+	group.wg.Add(1)
+	go func() {
+		defer group.wg.Done()
+		f.Run()
+		_, err := f.report(f.loadState())
+		group.finish(f, err)
+	}()
+	return f
+}
+
+// Wait blocks until all tasks of the group are done, and returns the first
+// error returned by them.
+func (group *TaskGroup) Wait() error {
+	group.wg.Wait()
+
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	return group.err
+}
+
+// Cancel interrupts all the tasks of this group and its sub groups, tasks
+// submitted after Cancel are cancelled immediately.
+func (group *TaskGroup) Cancel() {
+	group.mu.Lock()
+	if group.cancelled {
+		group.mu.Unlock()
+		return
+	}
+	group.cancelled = true
+	futures := group.futures
+	children := group.children
+	group.futures = nil
+	group.children = nil
+	group.mu.Unlock()
+
+	for f := range futures {
+		f.Cancel(true)
+	}
+	for _, child := range children {
+		child.Cancel()
+	}
+	group.cancel()
+}
+
+// finish forgets a finished task and records its error, cancellation of the
+// task by the group is not an error.
+func (group *TaskGroup) finish(f *FutureTask, err error) {
+	group.mu.Lock()
+	delete(group.futures, f)
+	first := err != nil && group.err == nil && !(group.cancelled && f.IsCancelled())
+	if first {
+		group.err = err
+	}
+	group.mu.Unlock()
+
+	if first {
+		group.Cancel()
+	}
+}
@@ -1 +1,3 @@
 module github.com/vvwyy/peanut
+
+go 1.24